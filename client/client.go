@@ -1,8 +1,12 @@
 package client
 
-import "net/url"
+import (
+	"context"
+	"net/url"
+)
 
 // base struct for all web clients
 type webClient struct {
+	ctx context.Context // cancels the pending requests when done
 	url *url.URL
 }
@@ -5,63 +5,68 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/Morphyni/tas-cli/types"
 	"github.com/Morphyni/tas-cli/utils"
 	log "github.com/sirupsen/logrus"
 )
 
-// DomainServer encapsulates the remote operations with the Atmosphere domain server
+// DomainServer encapsulates the remote operations with the Atmosphere domain server.
+// Errors sent back by the Domain Server are returned as *DomainServerError.
 type DomainServer interface {
 	// UpdateSandbox method updates a sandbox in the Domain Server
-	// UpdateSandbox(sandboxId string, bodyComponents []byte) (*types.SuccessResponse, error)
+	UpdateSandbox(sandboxId string, bodyComponents []byte) (*types.SuccessResponse, error)
 
-	// //GetOrgSandboxes method retrieves sandboxes of current organization
-	// GetOrgSandboxes() (*types.DomainServerGetSandboxesResponse, error)
+	//GetOrgSandboxes method retrieves sandboxes of current organization
+	GetOrgSandboxes() (*types.DomainServerGetSandboxesResponse, error)
 
-	// //GetDefaultSandbox method provides default sandbox of current organization
+	//GetDefaultSandbox method provides default sandbox of current organization
 	GetDefaultSandbox() (*types.DomainServerSandboxBean, int, error)
 
-	// // GetSandboxes method retrieves all sandboxes for the current user from Domain Server
-	// GetSandboxes(sandboxName, userName string) (*types.DomainServerGetSandboxesResponse, error)
+	// GetSandboxes method retrieves all sandboxes for the current user from Domain Server
+	GetSandboxes(sandboxName, userName string) (*types.DomainServerGetSandboxesResponse, error)
 
-	// // GetSandbox method retrieves a sandbox from Domain Server
-	// GetSandbox(sandboxId string) (*types.DomainServerSandboxBean, error)
+	// GetSandbox method retrieves a sandbox from Domain Server
+	GetSandbox(sandboxId string) (*types.DomainServerSandboxBean, error)
 
-	// // GetApplicationsInSandbox method retrieves the Applications Beans from Domain Server
-	// GetApplicationsInSandbox(sandboxId string) (*types.DomainServerApplicationsResponse, error, bool)
+	// GetApplicationsInSandbox method retrieves the Applications Beans from Domain Server, the last boolean return argument is true if the error is a simple sandbox not found
+	GetApplicationsInSandbox(sandboxId string) (*types.DomainServerApplicationsResponse, error, bool)
 
-	// // GetAllApplications method retrieves the all Applications Beans from Domain Server
-	// GetAllApplications() (*types.DomainServerApplicationsResponse, error, bool)
+	// GetAllApplications method retrieves the all Applications Beans from Domain Server, the last boolean return argument is true if the error is a simple not found
+	GetAllApplications() (*types.DomainServerApplicationsResponse, error, bool)
 
-	// // GetApplicationDetails method retrieves an App from Domain Server, the last boolean return argument is true if the error is a simple application not found on that sandbox
-	// GetApplicationDetails(appName, sandboxId string) (*types.DomainServerApplicationBean, error, bool)
+	// GetApplicationDetails method retrieves an App from Domain Server, the last boolean return argument is true if the error is a simple application not found on that sandbox
+	GetApplicationDetails(appName, sandboxId string) (*types.DomainServerApplicationBean, error, bool)
 
-	// // GetAppEndpoint method retrieves an App endpoint bean from Domain Server
-	// GetAppEndpoint(sandboxId, appId, endpointId string) (*types.DomainServerAppEndpointBean, error)
+	// GetAppEndpoint method retrieves an App endpoint bean from Domain Server
+	GetAppEndpoint(sandboxId, appId, endpointId string) (*types.DomainServerAppEndpointBean, error)
 
-	// // GetAppEndpointUrl method retrieves an App endpoint URL from Domain Server
-	// GetAppEndpointUrl(sandboxId, appId, endpointId string) (*types.DomainServerAppEndpointUrlResponse, error)
+	// GetAppEndpointUrl method retrieves an App endpoint URL from Domain Server
+	GetAppEndpointUrl(sandboxId, appId, endpointId string) (*types.DomainServerAppEndpointUrlResponse, error)
 
-	// // GetAppConfigDetails gets app config details
-	// GetAppConfigDetails(sandboxId, appId string) (*types.AppConfig, error)
+	// GetAppConfigDetails gets app config details
+	GetAppConfigDetails(sandboxId, appId string) (*types.AppConfig, error)
 
-	// // GetAllApplicationsBySbscId retrieves all apps belong to targetSbsc
-	// GetAllApplicationsBySbscId(targetSbscId string) (*types.DomainServerApplicationsResponse, error)
+	// GetAllApplicationsBySbscId retrieves all apps belong to targetSbsc
+	GetAllApplicationsBySbscId(targetSbscId string) (*types.DomainServerApplicationsResponse, error)
 
-	// // GetApps return apps by appName and jwt:role
-	// GetApps(appName string, role bool) ([]types.DomainServerApplicationBean, error)
+	// GetApps return apps by appName and jwt:role
+	GetApps(appName string, role bool) ([]types.DomainServerApplicationBean, error)
 
-	// // GetApp returns app by appId
-	// GetApp(appId string) (*types.DomainServerApplicationBean, error)
+	// GetApp returns app by appId
+	GetApp(appId string) (*types.DomainServerApplicationBean, error)
 
-	// // GetAppAudits
-	// GetAppAudits(appId string) (*types.DomainServerAppAudits, error)
+	// GetAppAudits returns the audit history of the app
+	GetAppAudits(appId string) (*types.DomainServerAppAudits, error)
 }
 
 // domainServer is the private implementation of the DomainServer interface
@@ -72,21 +77,21 @@ type domainServer struct {
 // make sure that the domainServer implements the DomainServer interface
 var _ DomainServer = (*domainServer)(nil)
 
-// NewDomainServer creates a new DomainServer object
-func NewDomainServer() (ds DomainServer, err error) {
+// NewDomainServer creates a new DomainServer object, its requests get aborted when ctx is done
+func NewDomainServer(ctx context.Context) (ds DomainServer, err error) {
 	serverURL, err := utils.GetDomainURL()
 	if err != nil {
 		return nil, err
 	}
 	if parsedURL, err := url.Parse(serverURL); err == nil {
-		return &domainServer{webClient: webClient{url: parsedURL}}, nil
+		return &domainServer{webClient: webClient{ctx: ctx, url: parsedURL}}, nil
 	} else {
 		return nil, err
 	}
 }
 
-// NewDomainServerV2 creates a new DomainServer object
-func NewDomainServerV2(domainURL string) (ds DomainServer, err error) {
+// NewDomainServerV2 creates a new DomainServer object, its requests get aborted when ctx is done
+func NewDomainServerV2(ctx context.Context, domainURL string) (ds DomainServer, err error) {
 	var serverURL string
 	if len(domainURL) > 0 {
 		serverURL = domainURL
@@ -97,54 +102,280 @@ func NewDomainServerV2(domainURL string) (ds DomainServer, err error) {
 		}
 	}
 	if parsedURL, err := url.Parse(serverURL); err == nil {
-		return &domainServer{webClient: webClient{url: parsedURL}}, nil
+		return &domainServer{webClient: webClient{ctx: ctx, url: parsedURL}}, nil
 	}
 	return nil, err
 }
 
-func (c *domainServer) GetDefaultSandbox() (*types.DomainServerSandboxBean, int, error) {
+// DomainServerError is returned when the Domain Server responds with an error, or can't be reached at all
+// (HttpCode is then utils.HTTP_CONNECTION_ERROR_CODE)
+type DomainServerError struct {
+	Method      string
+	Url         string
+	HttpCode    int
+	ErrorCode   string
+	ErrorMsg    string
+	ErrorDetail string
+}
+
+func (e *DomainServerError) Error() string {
+	return e.ErrorMsg
+}
+
+// IsNotFound tells whether the error is the Domain Server not finding the requested sandbox, app, etc.
+func IsNotFound(err error) bool {
+	var dsErr *DomainServerError
+	return errors.As(err, &dsErr) && dsErr.HttpCode == http.StatusNotFound
+}
+
+// IsSessionExpired tells whether the error is the Domain Server rejecting the session cookies. The backend may also
+// answer with the utils.HTTP_CONNECTION_ERROR_CODE, the 419 code being then found in the error message.
+func IsSessionExpired(err error) bool {
+	var dsErr *DomainServerError
+	if !errors.As(err, &dsErr) {
+		return false
+	}
+	switch dsErr.HttpCode {
+	case http.StatusUnauthorized, 419:
+		return true
+	case utils.HTTP_CONNECTION_ERROR_CODE:
+		return strings.Contains(dsErr.ErrorMsg, "419")
+	}
+	return false
+}
+
+// call sends a request to the given API of the Domain Server and decodes the JSON response into out, if not nil.
+// body is sent as is if it's a []byte, else JSON encoded. It returns the HTTP status code along with the error if any.
+func (c *domainServer) call(method, apiPath string, query url.Values, body interface{}, out interface{}) (int, error) {
+	callURL := *c.url
+	// the ids in the API paths are escaped, they are sent as is
+	path, err := url.PathUnescape(apiPath)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	callURL.Path, callURL.RawPath = path, apiPath
+	callURL.RawQuery = query.Encode()
 
-	c.url.Path = utils.GetDomainServerDefaultSandboxAPI()
+	var bodyReader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		bodyReader = bytes.NewReader(b)
+	default:
+		bodyBytes, err := json.Marshal(b)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		bodyReader = bytes.NewReader(bodyBytes)
+	}
 
-	log.Debugf("Sending GetDefaultSandbox against url: '%s'", c.url.String())
+	log.Debugf("Sending %s against url: '%s'", method, callURL.String())
 
 	response, restCallAndCookieRefreshErr := utils.RestCallAndCookiesRefreshHandler(
 		&types.RestCallRequest{
-			Url:          c.url,
+			Context:      c.ctx,
+			Service:      "Domain Server",
+			Url:          &callURL,
 			Headers:      map[string]string{"Content-Type": "application/json"},
-			Method:       http.MethodGet,
-			Body:         nil,
+			Method:       method,
+			Body:         bodyReader,
 			LogRequest:   false,
 			UserId:       "",
-			RetryAttempt: nil,
+			RetryAttempt: utils.GetRetryAttempt(),
 		})
 
 	if restCallAndCookieRefreshErr != nil {
 		log.Debugf("Rest call and refresh cookies failed on error: '%+v'", restCallAndCookieRefreshErr.Error())
-		return nil, http.StatusInternalServerError, restCallAndCookieRefreshErr
+		return http.StatusInternalServerError, restCallAndCookieRefreshErr
 	}
 
 	if utils.IsDevMode() {
-		log.Debugf("Response for DomainServer GetDefaultSandbox request: %+v", response)
+		log.Debugf("Response for DomainServer %s '%s' request: %+v", method, callURL.String(), response)
 	}
 
 	if response.ErrorResponse != nil {
 		atmosError := response.ErrorResponse
-		errMsg := fmt.Sprintf("Error for GET '%s' url: ErrorCode: %s, ErrorMsg: %s, ErrorDetail: %s .",
-			c.url.String(), atmosError.ErrorCode, atmosError.ErrorMsg, atmosError.ErrorDetail)
-		log.Debug(errMsg)
-		return nil, response.HttpCode, errors.New(atmosError.ErrorMsg)
+		log.Debugf("Error for %s '%s' url: ErrorCode: %s, ErrorMsg: %s, ErrorDetail: %s .",
+			method, callURL.String(), atmosError.ErrorCode, atmosError.ErrorMsg, atmosError.ErrorDetail)
+		return response.HttpCode, &DomainServerError{
+			Method:      method,
+			Url:         callURL.String(),
+			HttpCode:    response.HttpCode,
+			ErrorCode:   atmosError.ErrorCode,
+			ErrorMsg:    atmosError.ErrorMsg,
+			ErrorDetail: atmosError.ErrorDetail,
+		}
+	}
+
+	if out != nil {
+		//Populate a structure type with the byte data returned by the REST Call
+		if err := json.Unmarshal(response.ResponseBytes, out); err != nil {
+			if utils.IsDevMode() {
+				utils.PrintStackTrace(2, err.Error())
+			}
+			return http.StatusInternalServerError, errors.New(fmt.Sprintf("Unexpected response for %s '%s': %s", method, callURL.String(), err.Error()))
+		}
+	}
+	return response.HttpCode, nil
+}
+
+func (c *domainServer) GetDefaultSandbox() (*types.DomainServerSandboxBean, int, error) {
+	sandboxBean := &types.DomainServerSandboxBean{}
+	httpCode, err := c.call(http.MethodGet, utils.GetDomainServerDefaultSandboxAPI(), nil, nil, sandboxBean)
+	if err != nil {
+		return nil, httpCode, err
+	}
+	return sandboxBean, httpCode, nil
+}
+
+func (c *domainServer) UpdateSandbox(sandboxId string, bodyComponents []byte) (*types.SuccessResponse, error) {
+	successResponse := &types.SuccessResponse{}
+	if _, err := c.call(http.MethodPut, utils.GetDomainServerGetSandboxAPI(sandboxId), nil, bodyComponents, successResponse); err != nil {
+		return nil, err
+	}
+	return successResponse, nil
+}
+
+func (c *domainServer) GetOrgSandboxes() (*types.DomainServerGetSandboxesResponse, error) {
+	sandboxesResponse := &types.DomainServerGetSandboxesResponse{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerGetOpSandboxesAPI(), nil, nil, sandboxesResponse); err != nil {
+		return nil, err
 	}
+	return sandboxesResponse, nil
+}
 
+// GetSandboxes filters the sandboxes by name and user when given
+func (c *domainServer) GetSandboxes(sandboxName, userName string) (*types.DomainServerGetSandboxesResponse, error) {
+	query := url.Values{}
+	if len(sandboxName) > 0 {
+		query.Set("sandboxName", sandboxName)
+	}
+	if len(userName) > 0 {
+		query.Set("userName", userName)
+	}
+	sandboxesResponse := &types.DomainServerGetSandboxesResponse{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerGetSandboxesAPI(), query, nil, sandboxesResponse); err != nil {
+		return nil, err
+	}
+	return sandboxesResponse, nil
+}
+
+func (c *domainServer) GetSandbox(sandboxId string) (*types.DomainServerSandboxBean, error) {
 	sandboxBean := &types.DomainServerSandboxBean{}
-	//Populate a structure type with the byte data returned by the REST Call
-	err3 := json.Unmarshal(response.ResponseBytes, &sandboxBean)
-	if err3 != nil {
-		if utils.IsDevMode() {
-			utilities.PrintStackTrace(2, err3.Error())
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerGetSandboxAPI(sandboxId), nil, nil, sandboxBean); err != nil {
+		return nil, err
+	}
+	return sandboxBean, nil
+}
+
+func (c *domainServer) GetApplicationsInSandbox(sandboxId string) (*types.DomainServerApplicationsResponse, error, bool) {
+	appsResponse := &types.DomainServerApplicationsResponse{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerListAppsAPI(sandboxId), nil, nil, appsResponse); err != nil {
+		return nil, err, IsNotFound(err)
+	}
+	return appsResponse, nil, false
+}
+
+func (c *domainServer) GetAllApplications() (*types.DomainServerApplicationsResponse, error, bool) {
+	appsResponse := &types.DomainServerApplicationsResponse{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerListAllAppsAPI(), nil, nil, appsResponse); err != nil {
+		return nil, err, IsNotFound(err)
+	}
+	return appsResponse, nil, false
+}
+
+// GetApplicationDetails looks the app up by name among the apps of the sandbox, then retrieves its details
+func (c *domainServer) GetApplicationDetails(appName, sandboxId string) (*types.DomainServerApplicationBean, error, bool) {
+	appsResponse, err, notFound := c.GetApplicationsInSandbox(sandboxId)
+	if err != nil {
+		return nil, err, notFound
+	}
+	for _, app := range appsResponse.ApplicationBeans {
+		if app.ApplicationName != appName {
+			continue
+		}
+		appBean := &types.DomainServerApplicationBean{}
+		if _, err := c.call(http.MethodGet, utils.GetDomainServerGetAppDetailsAPI(sandboxId, app.Id), nil, nil, appBean); err != nil {
+			return nil, err, IsNotFound(err)
+		}
+		return appBean, nil, false
+	}
+	return nil, errors.New(fmt.Sprintf("Application '%s' not found in sandbox '%s'.", appName, sandboxId)), true
+}
+
+func (c *domainServer) GetAppEndpoint(sandboxId, appId, endpointId string) (*types.DomainServerAppEndpointBean, error) {
+	endpointBean := &types.DomainServerAppEndpointBean{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerGetAppEndpointAPI(sandboxId, appId, endpointId), nil, nil, endpointBean); err != nil {
+		return nil, err
+	}
+	return endpointBean, nil
+}
+
+func (c *domainServer) GetAppEndpointUrl(sandboxId, appId, endpointId string) (*types.DomainServerAppEndpointUrlResponse, error) {
+	endpointUrlResponse := &types.DomainServerAppEndpointUrlResponse{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerGetAppEndpointURLAPI(sandboxId, appId, endpointId), nil, nil, endpointUrlResponse); err != nil {
+		return nil, err
+	}
+	return endpointUrlResponse, nil
+}
+
+func (c *domainServer) GetAppConfigDetails(sandboxId, appId string) (*types.AppConfig, error) {
+	appConfig := &types.AppConfig{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerGetAppConfigAPI(sandboxId, appId), nil, nil, appConfig); err != nil {
+		return nil, err
+	}
+	return appConfig, nil
+}
+
+func (c *domainServer) GetAllApplicationsBySbscId(targetSbscId string) (*types.DomainServerApplicationsResponse, error) {
+	appsResponse, err, _ := c.GetAllApplications()
+	if err != nil {
+		return nil, err
+	}
+	filtered := &types.DomainServerApplicationsResponse{ApplicationBeans: []types.DomainServerApplicationBean{}}
+	for _, app := range appsResponse.ApplicationBeans {
+		if app.SubscriptionId == targetSbscId {
+			filtered.ApplicationBeans = append(filtered.ApplicationBeans, app)
+		}
+	}
+	return filtered, nil
+}
+
+// GetApps returns the apps of the given name, all of them if empty. With role set, only the apps the role in the
+// user's JWT grants access to are returned by the Domain Server.
+func (c *domainServer) GetApps(appName string, role bool) ([]types.DomainServerApplicationBean, error) {
+	query := url.Values{}
+	if len(appName) > 0 {
+		query.Set("applicationName", appName)
+	}
+	if role {
+		query.Set("role", "true")
+	}
+	appsResponse := &types.DomainServerApplicationsResponse{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerListAllAppsAPI(), query, nil, appsResponse); err != nil {
+		return nil, err
+	}
+	apps := []types.DomainServerApplicationBean{}
+	for _, app := range appsResponse.ApplicationBeans {
+		if len(appName) == 0 || app.ApplicationName == appName {
+			apps = append(apps, app)
 		}
-		return nil, http.StatusInternalServerError, err3
 	}
+	return apps, nil
+}
 
-	return sandboxBean, response.HttpCode, nil
+func (c *domainServer) GetApp(appId string) (*types.DomainServerApplicationBean, error) {
+	appBean := &types.DomainServerApplicationBean{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerGetAppByIdAPI(appId), nil, nil, appBean); err != nil {
+		return nil, err
+	}
+	return appBean, nil
+}
+
+func (c *domainServer) GetAppAudits(appId string) (*types.DomainServerAppAudits, error) {
+	appAudits := &types.DomainServerAppAudits{}
+	if _, err := c.call(http.MethodGet, utils.GetDomainServerFetchAppAuditsAPI(appId), nil, nil, appAudits); err != nil {
+		return nil, err
+	}
+	return appAudits, nil
 }
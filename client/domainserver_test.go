@@ -0,0 +1,346 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/types"
+	"github.com/Morphyni/tas-cli/utils"
+)
+
+func TestMain(m *testing.M) {
+	// the calls load the session cookies from the settings
+	dir, err := ioutil.TempDir("", "tas-cli-client-test")
+	if err != nil {
+		panic(err)
+	}
+	if err = settings.SetSettingsDir(dir); err != nil {
+		panic(err)
+	}
+	// errors are tested once, without waiting for retries
+	utils.SetRetryPolicy(0, 0)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeDomainServer answers the requests with the response registered for their method & escaped path, 404 if none
+type fakeDomainServer struct {
+	*httptest.Server
+	lock      sync.Mutex
+	responses map[string]string
+	requests  []string
+	bodies    []string
+}
+
+func newFakeDomainServer(responses map[string]string) *fakeDomainServer {
+	fs := &fakeDomainServer{responses: responses}
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		request := r.Method + " " + r.URL.EscapedPath()
+		if r.URL.RawQuery != "" {
+			request += "?" + r.URL.RawQuery
+		}
+		fs.lock.Lock()
+		fs.requests = append(fs.requests, request)
+		fs.bodies = append(fs.bodies, string(body))
+		response, ok := fs.responses[r.Method+" "+r.URL.EscapedPath()]
+		fs.lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"TCI-404","errorMsg":"Not found","errorDetail":"` + r.URL.Path + `"}`))
+			return
+		}
+		w.Write([]byte(response))
+	}))
+	return fs
+}
+
+func newTestClient(t *testing.T, fs *fakeDomainServer) DomainServer {
+	ds, err := NewDomainServerV2(context.Background(), fs.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds
+}
+
+func TestDomainServerCalls(t *testing.T) {
+	sandboxPath := utils.GetDomainServerGetSandboxAPI("sbx-1")
+	// an id with characters that would change the path or start a query
+	oddSandboxPath := utils.GetDomainServerGetSandboxAPI("a/b?c%d")
+	appsPath := utils.GetDomainServerListAppsAPI("sbx-1")
+	allAppsPath := utils.GetDomainServerListAllAppsAPI()
+	appDetailsPath := utils.GetDomainServerGetAppDetailsAPI("sbx-1", "app-1")
+	endpointPath := utils.GetDomainServerGetAppEndpointAPI("sbx-1", "app-1", "ep-1")
+	endpointURLPath := utils.GetDomainServerGetAppEndpointURLAPI("sbx-1", "app-1", "ep-1")
+	configPath := utils.GetDomainServerGetAppConfigAPI("sbx-1", "app-1")
+	appPath := utils.GetDomainServerGetAppByIdAPI("app-1")
+	auditsPath := utils.GetDomainServerFetchAppAuditsAPI("app-1")
+	sandboxesPath := utils.GetDomainServerGetSandboxesAPI()
+	orgSandboxesPath := utils.GetDomainServerGetOpSandboxesAPI()
+	defaultSandboxPath := utils.GetDomainServerDefaultSandboxAPI()
+
+	sandbox := `{"id":"sbx-1","sandboxName":"MySandbox","applicationIds":["app-1"]}`
+	apps := `{"applications":[{"id":"app-1","applicationName":"orders","subscriptionId":"sub-1"},` +
+		`{"id":"app-2","applicationName":"billing","subscriptionId":"sub-2"}]}`
+	server := newFakeDomainServer(map[string]string{
+		"GET " + defaultSandboxPath: sandbox,
+		"PUT " + sandboxPath:        `{"message":"Sandbox updated."}`,
+		"GET " + sandboxPath:        sandbox,
+		"GET " + oddSandboxPath:     `{"id":"a/b?c%d"}`,
+		"GET " + sandboxesPath:      `{"sandboxes":[` + sandbox + `],"operationWarning":"partial"}`,
+		"GET " + orgSandboxesPath:   `{"sandboxes":[` + sandbox + `,{"id":"sbx-2"}]}`,
+		"GET " + appsPath:           apps,
+		"GET " + allAppsPath:        apps,
+		"GET " + appDetailsPath:     `{"id":"app-1","applicationName":"orders","version":"1.2"}`,
+		"GET " + endpointPath:       `{"type":"public"}`,
+		"GET " + endpointURLPath:    `{"endpointUrl":"https://orders.example.com"}`,
+		"GET " + configPath:         `{"propertyPrefix":"orders."}`,
+		"GET " + appPath:            `{"id":"app-1","applicationName":"orders"}`,
+		"GET " + auditsPath:         `{"totalNum":1,"audits":[{"appId":"app-1","createdTime":1546300800000}]}`,
+	})
+	defer server.Close()
+	ds := newTestClient(t, server)
+
+	tests := []struct {
+		name string
+		call func() (interface{}, error)
+		// requests expected, as method, path & query
+		requests []string
+		expected interface{}
+	}{
+		{
+			name: "GetDefaultSandbox",
+			call: func() (interface{}, error) {
+				bean, _, err := ds.GetDefaultSandbox()
+				return bean, err
+			},
+			requests: []string{"GET " + defaultSandboxPath},
+			expected: &types.DomainServerSandboxBean{Id: "sbx-1", SandboxName: "MySandbox", ApplicationIds: []string{"app-1"}},
+		},
+		{
+			name:     "UpdateSandbox",
+			call:     func() (interface{}, error) { return ds.UpdateSandbox("sbx-1", []byte(`{"displayName":"Mine"}`)) },
+			requests: []string{"PUT " + sandboxPath},
+			expected: &types.SuccessResponse{Message: "Sandbox updated."},
+		},
+		{
+			name:     "GetOrgSandboxes",
+			call:     func() (interface{}, error) { return ds.GetOrgSandboxes() },
+			requests: []string{"GET " + orgSandboxesPath},
+			expected: &types.DomainServerGetSandboxesResponse{
+				Sandboxes: []types.DomainServerSandboxBean{{Id: "sbx-1", SandboxName: "MySandbox", ApplicationIds: []string{"app-1"}}, {Id: "sbx-2"}},
+			},
+		},
+		{
+			name:     "GetSandboxes",
+			call:     func() (interface{}, error) { return ds.GetSandboxes("MySandbox", "jack@example.com") },
+			requests: []string{"GET " + sandboxesPath + "?sandboxName=MySandbox&userName=jack%40example.com"},
+			expected: &types.DomainServerGetSandboxesResponse{
+				Sandboxes:        []types.DomainServerSandboxBean{{Id: "sbx-1", SandboxName: "MySandbox", ApplicationIds: []string{"app-1"}}},
+				OperationWarning: "partial",
+			},
+		},
+		{
+			name:     "GetSandbox",
+			call:     func() (interface{}, error) { return ds.GetSandbox("sbx-1") },
+			requests: []string{"GET " + sandboxPath},
+			expected: &types.DomainServerSandboxBean{Id: "sbx-1", SandboxName: "MySandbox", ApplicationIds: []string{"app-1"}},
+		},
+		{
+			name:     "GetSandbox with an id to escape",
+			call:     func() (interface{}, error) { return ds.GetSandbox("a/b?c%d") },
+			requests: []string{"GET " + utils.GetDomainServerGetSandboxesAPI() + "/a%2Fb%3Fc%25d"},
+			expected: &types.DomainServerSandboxBean{Id: "a/b?c%d"},
+		},
+		{
+			name: "GetApplicationsInSandbox",
+			call: func() (interface{}, error) {
+				response, err, _ := ds.GetApplicationsInSandbox("sbx-1")
+				return response, err
+			},
+			requests: []string{"GET " + appsPath},
+			expected: &types.DomainServerApplicationsResponse{ApplicationBeans: []types.DomainServerApplicationBean{
+				{Id: "app-1", ApplicationName: "orders", SubscriptionId: "sub-1"},
+				{Id: "app-2", ApplicationName: "billing", SubscriptionId: "sub-2"},
+			}},
+		},
+		{
+			name: "GetAllApplications",
+			call: func() (interface{}, error) {
+				response, err, _ := ds.GetAllApplications()
+				return response, err
+			},
+			requests: []string{"GET " + allAppsPath},
+			expected: &types.DomainServerApplicationsResponse{ApplicationBeans: []types.DomainServerApplicationBean{
+				{Id: "app-1", ApplicationName: "orders", SubscriptionId: "sub-1"},
+				{Id: "app-2", ApplicationName: "billing", SubscriptionId: "sub-2"},
+			}},
+		},
+		{
+			name: "GetApplicationDetails",
+			call: func() (interface{}, error) {
+				bean, err, _ := ds.GetApplicationDetails("orders", "sbx-1")
+				return bean, err
+			},
+			requests: []string{"GET " + appsPath, "GET " + appDetailsPath},
+			expected: &types.DomainServerApplicationBean{Id: "app-1", ApplicationName: "orders", Version: "1.2"},
+		},
+		{
+			name:     "GetAppEndpoint",
+			call:     func() (interface{}, error) { return ds.GetAppEndpoint("sbx-1", "app-1", "ep-1") },
+			requests: []string{"GET " + endpointPath},
+			expected: &types.DomainServerAppEndpointBean{Type: "public"},
+		},
+		{
+			name:     "GetAppEndpointUrl",
+			call:     func() (interface{}, error) { return ds.GetAppEndpointUrl("sbx-1", "app-1", "ep-1") },
+			requests: []string{"GET " + endpointURLPath},
+			expected: &types.DomainServerAppEndpointUrlResponse{EndpointUrl: "https://orders.example.com"},
+		},
+		{
+			name:     "GetAppConfigDetails",
+			call:     func() (interface{}, error) { return ds.GetAppConfigDetails("sbx-1", "app-1") },
+			requests: []string{"GET " + configPath},
+			expected: &types.AppConfig{PropertyPrefix: "orders."},
+		},
+		{
+			name:     "GetAllApplicationsBySbscId",
+			call:     func() (interface{}, error) { return ds.GetAllApplicationsBySbscId("sub-2") },
+			requests: []string{"GET " + allAppsPath},
+			expected: &types.DomainServerApplicationsResponse{ApplicationBeans: []types.DomainServerApplicationBean{
+				{Id: "app-2", ApplicationName: "billing", SubscriptionId: "sub-2"},
+			}},
+		},
+		{
+			name:     "GetApps",
+			call:     func() (interface{}, error) { return ds.GetApps("orders", true) },
+			requests: []string{"GET " + allAppsPath + "?applicationName=orders&role=true"},
+			expected: []types.DomainServerApplicationBean{{Id: "app-1", ApplicationName: "orders", SubscriptionId: "sub-1"}},
+		},
+		{
+			name:     "GetApp",
+			call:     func() (interface{}, error) { return ds.GetApp("app-1") },
+			requests: []string{"GET " + appPath},
+			expected: &types.DomainServerApplicationBean{Id: "app-1", ApplicationName: "orders"},
+		},
+		{
+			name:     "GetAppAudits",
+			call:     func() (interface{}, error) { return ds.GetAppAudits("app-1") },
+			requests: []string{"GET " + auditsPath},
+			expected: &types.DomainServerAppAudits{TotalNum: 1, Audits: []types.DomainServerAppAudit{{AppId: "app-1", CreatedTime: 1546300800000}}},
+		},
+	}
+
+	for _, test := range tests {
+		server.lock.Lock()
+		server.requests, server.bodies = nil, nil
+		server.lock.Unlock()
+
+		result, err := test.call()
+		if err != nil {
+			t.Errorf("%s failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(server.requests, test.requests) {
+			t.Errorf("%s sent %v, expected %v", test.name, server.requests, test.requests)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s decoded %+v, expected %+v", test.name, result, test.expected)
+		}
+	}
+
+	// the body of the update goes as is
+	server.requests, server.bodies = nil, nil
+	if _, err := ds.UpdateSandbox("sbx-1", []byte(`{"displayName":"Mine"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if server.bodies[0] != `{"displayName":"Mine"}` {
+		t.Errorf("UpdateSandbox sent '%s', expected the given body", server.bodies[0])
+	}
+}
+
+func TestDomainServerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("sandboxName") {
+		case "missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errorCode":"TCI-404","errorMsg":"Sandbox not found","errorDetail":"missing"}`))
+		case "unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"errorCode":"TCI-401","errorMsg":"Unauthorized"}`))
+		case "expired":
+			w.WriteHeader(419)
+			w.Write([]byte(`Session expired`))
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<html>Service Unavailable</html>`))
+		case "invalid":
+			w.Write([]byte(`{"sandboxes":`))
+		}
+	}))
+	defer server.Close()
+	ds, err := NewDomainServerV2(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sandboxName    string
+		httpCode       int
+		errorCode      string
+		errorMsg       string
+		notFound       bool
+		sessionExpired bool
+	}{
+		{"missing", http.StatusNotFound, "TCI-404", "Sandbox not found", true, false},
+		{"unauthorized", http.StatusUnauthorized, "TCI-401", "Unauthorized", false, true},
+		{"expired", 419, "419", "419 status code 419", false, true},
+		{"unavailable", http.StatusServiceUnavailable, "503", "503 Service Unavailable", false, false},
+	}
+	for _, test := range tests {
+		_, err := ds.GetSandboxes(test.sandboxName, "")
+		dsErr, ok := err.(*DomainServerError)
+		if !ok {
+			t.Errorf("%s: got '%v', expected a DomainServerError", test.sandboxName, err)
+			continue
+		}
+		if dsErr.Method != http.MethodGet || !strings.HasPrefix(dsErr.Url, server.URL) || dsErr.HttpCode != test.httpCode ||
+			dsErr.ErrorCode != test.errorCode || dsErr.ErrorMsg != test.errorMsg {
+			t.Errorf("%s: got %+v", test.sandboxName, dsErr)
+		}
+		if IsNotFound(err) != test.notFound {
+			t.Errorf("%s: IsNotFound is %t, expected %t", test.sandboxName, IsNotFound(err), test.notFound)
+		}
+		if IsSessionExpired(err) != test.sessionExpired {
+			t.Errorf("%s: IsSessionExpired is %t, expected %t", test.sandboxName, IsSessionExpired(err), test.sessionExpired)
+		}
+	}
+
+	if _, err := ds.GetSandboxes("invalid", ""); err == nil || !strings.Contains(err.Error(), "Unexpected response") {
+		t.Errorf("Invalid JSON gave '%v', expected an unexpected response error", err)
+	}
+
+	// the backend may report an expired session through a connection error
+	connectionErr := &DomainServerError{HttpCode: utils.HTTP_CONNECTION_ERROR_CODE, ErrorMsg: "Backend answered 419"}
+	if !IsSessionExpired(connectionErr) || IsNotFound(connectionErr) {
+		t.Errorf("Connection error mentioning 419 should be an expired session")
+	}
+
+	server.Close()
+	_, err = ds.GetSandboxes("missing", "")
+	dsErr, ok := err.(*DomainServerError)
+	if !ok || dsErr.HttpCode != utils.HTTP_CONNECTION_ERROR_CODE || IsNotFound(err) || IsSessionExpired(err) {
+		t.Errorf("Unreachable server gave '%+v', expected a connection error", err)
+	}
+}
@@ -6,7 +6,7 @@ package client
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,14 +14,20 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"strings"
 
 	"github.com/Morphyni/tas-cli/consts"
 	"github.com/Morphyni/tas-cli/settings"
 	"github.com/Morphyni/tas-cli/types"
+	"github.com/Morphyni/tas-cli/utils"
 	log "github.com/sirupsen/logrus"
 )
 
+// Token type hints of the tokens revoked on logout, see RFC 7009
+const (
+	ACCESS_TOKEN_TYPE_HINT  = "access_token"
+	REFRESH_TOKEN_TYPE_HINT = "refresh_token"
+)
+
 // OAuth2 encapsulates the communications with TIBCO Account's OAuth2 server
 type OAuth2 interface {
 	Login(types.AuthRequest) (*types.OAResponse, error)
@@ -32,6 +38,7 @@ type OAuth2 interface {
 }
 
 type oAuthClient struct {
+	ctx     context.Context // cancels the pending requests when done
 	url     *url.URL
 	profile *settings.Profile
 }
@@ -39,10 +46,10 @@ type oAuthClient struct {
 // Enforce implementation of OAuth2 interface
 var _ OAuth2 = (*oAuthClient)(nil)
 
-//constructor
-func NewOAuthClient(serverURL string) (OAuth2, error) {
+//constructor, the requests get aborted when ctx is done
+func NewOAuthClient(ctx context.Context, serverURL string) (OAuth2, error) {
 	if parsedURL, err := url.Parse(serverURL); err == nil {
-		return &oAuthClient{url: parsedURL}, nil
+		return &oAuthClient{ctx: ctx, url: parsedURL}, nil
 	} else {
 		return nil, err
 	}
@@ -58,7 +65,7 @@ func (client *oAuthClient) Login(rqst types.AuthRequest) (*types.OAResponse, err
 		//		"scope"        : {rqst.Scope},
 		//		"client_secret": {rqst.ClientSecret},
 	}
-	return postData(data.Encode(), "application/x-www-form-urlencoded", client.url.String())
+	return postData(client.ctx, data.Encode(), "application/x-www-form-urlencoded", client.url.String())
 }
 
 func (client *oAuthClient) Renew(rqst types.FollowupRequest) (*types.OAResponse, error) {
@@ -69,101 +76,82 @@ func (client *oAuthClient) Renew(rqst types.FollowupRequest) (*types.OAResponse,
 		"client_id":     {rqst.ClientId},
 		"client_secret": {rqst.ClientSecret},
 	}
-	return postData(data.Encode(), "application/x-www-form-urlencoded", client.url.String())
+	return postData(client.ctx, data.Encode(), "application/x-www-form-urlencoded", client.url.String())
 }
 
+// Logout revokes the access token of the request, or its refresh token if TokenTypeHint says so. The token is
+// posted form-encoded along with the client credentials, as RFC 7009 requires.
 func (client *oAuthClient) Logout(req types.FollowupRequest) (*types.OAResponse, error) {
-	data := fmt.Sprintf("{access_token:\"%v\",client_id:\"%v\",client_secret:\"%v\"}",
-		req.Token, req.ClientId, req.ClientSecret)
-	return postData(data, "application/json", client.url.String()+"/revoke")
-}
-
-func postData(data, contentType, url string) (oaResponse *types.OAResponse, err error) {
-	request, err := http.NewRequest("POST", url, bytes.NewBufferString(data))
-	if err != nil {
-		return nil, err
+	tokenTypeHint := req.TokenTypeHint
+	if len(tokenTypeHint) == 0 {
+		tokenTypeHint = ACCESS_TOKEN_TYPE_HINT
+	}
+	data := url.Values{
+		"token":           {req.Token},
+		"token_type_hint": {tokenTypeHint},
+		"client_id":       {req.ClientId},
+		"client_secret":   {req.ClientSecret},
 	}
-	request.Header.Add("Content-Type", contentType)
+	return postData(client.ctx, data.Encode(), "application/x-www-form-urlencoded", client.url.String()+"/revoke")
+}
 
-	httpClient := http.DefaultClient
-	if strings.HasPrefix(url, "https") {
-		err, tciDeploymentName := settings.GetPlaceHolderValue(settings.DEPLOYMENT_NAME_PLACEHOLDER)
+func postData(ctx context.Context, data, contentType, url string) (oaResponse *types.OAResponse, err error) {
+	newRequest := func() (*http.Request, error) {
+		request, err := http.NewRequest("POST", url, bytes.NewBufferString(data))
 		if err != nil {
-			log.Debug(err.Error())
 			return nil, err
 		}
-		if len(tciDeploymentName) > 0 {
-			tr := &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true,
-				},
-				DisableCompression: true,
-				DisableKeepAlives:  true,
-			}
-			//tr.TLSClientConfig.RootCAs.AppendCertsFromPEM([]byte(cert_DigiCert_SHA2_High_Assurance_Server_CA)) system's are ok
-			httpClient = &http.Client{Transport: tr}
-			log.Debugf("Using %v to connect to %v ", tr, url)
-		} else {
-			tr := &http.Transport{
-				TLSClientConfig: &tls.Config{
-					//	RootCAs: x509.NewCertPool() //we're not adding new roots
-				},
-				DisableCompression: true,
-				DisableKeepAlives:  true,
-			}
-			//tr.TLSClientConfig.RootCAs.AppendCertsFromPEM([]byte(cert_DigiCert_SHA2_High_Assurance_Server_CA)) system's are ok
-			httpClient = &http.Client{Transport: tr}
-			log.Debugf("Using %v to connect to %v ", tr, url)
+		request.Header.Add("Content-Type", contentType)
+		if os.Getenv(consts.TASCLI_DBG) != "" {
+			log.Debugf("About to post %s", utils.DumpRequest(request, []byte(data)))
 		}
+		return request, nil
 	}
 
-	if os.Getenv(consts.TASCLI_DBG) != "" {
-		log.Debugf("About to post %v ", request)
-	}
-	response, err := httpClient.Do(request)
-
+	response, _, err := utils.DoWithRetry(ctx, utils.NewHTTPClient(nil), newRequest, utils.GetRetryAttempt())
 	if err != nil {
-		if response != nil {
-			request.Close = true
-			request.Body.Close()
-			response.Body.Close()
-		}
-		return nil, err
+		return nil, utils.CheckTimeout(ctx, err, "TIBCO Accounts")
 	}
 	readBody, _ := ioutil.ReadAll(response.Body)
-	request.Body.Close()
+	response.Body.Close()
 
 	oaResponse = &types.OAResponse{}
 
 	//	time.Sleep(250 * time.Millisecond)//that's a bug in Go but even their own test does that
 
-	if response.StatusCode != 200 {
-		log.Debugf("Response unsuccessful: %v %v.", response.Status, string(readBody))
+	success := response.StatusCode >= 200 && response.StatusCode < 300
+	if !success {
+		log.Debugf("Response unsuccessful: %v %v.", response.Status, utils.RedactString(string(readBody)))
+	}
+	if success && len(bytes.TrimSpace(readBody)) == 0 {
+		//a successful revocation may come without any content, see RFC 7009
+		log.Debugf("Response %v without content.", response.Status)
+		return
 	}
-	if readBody != nil {
+	if len(readBody) > 0 {
 		if os.Getenv(consts.TASCLI_DBG) != "" {
-			log.Debugf("Raw response was: %v", string(readBody))
+			log.Debugf("Raw response was: %s", utils.DumpResponse(response, readBody))
 		}
 		if err = json.Unmarshal(readBody, oaResponse); err == nil {
 			//we parsed the response but need to check the status code
-			if response.StatusCode != 200 {
+			if !success {
 				log.Debugf("Returning %v", oaResponse.ErrorDesc)
 				return nil, errors.New(oaResponse.ErrorDesc)
 			}
 			//else it's a success; fall through
 		} else {
 			//can't parse JSON; return HTTP error
-			if response.StatusCode != 200 {
+			if !success {
 				return nil, errors.New(response.Status + " " + string(readBody)) //TODO use error code
 			}
-			//200 but no JSON ?!
+			//2xx but no JSON ?!
 			return nil, errors.New(fmt.Sprintf("Unexpected content: '%+v': %+v", readBody, err))
 		}
 	} else {
 		return nil, errors.New(response.Status)
 	}
 	if os.Getenv(consts.TASCLI_DBG) != "" {
-		log.Debugf("Returinng successfully parsed response: %v", oaResponse)
+		log.Debugf("Returning successfully parsed response, access token expiring in %ds", oaResponse.ExpiresIn)
 	}
 	return
 }
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/Morphyni/tas-cli/types"
+)
+
+func TestLogoutRevokesForm(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  types.FollowupRequest
+		expected url.Values
+	}{
+		{
+			name:    "access token by default",
+			request: types.FollowupRequest{Token: "access-value", ClientId: "cli"},
+			expected: url.Values{"token": {"access-value"}, "token_type_hint": {ACCESS_TOKEN_TYPE_HINT},
+				"client_id": {"cli"}, "client_secret": {""}},
+		},
+		{
+			name: "refresh token",
+			request: types.FollowupRequest{Token: "refresh-value", ClientId: "cli", ClientSecret: "s3cret",
+				TokenTypeHint: REFRESH_TOKEN_TYPE_HINT},
+			expected: url.Values{"token": {"refresh-value"}, "token_type_hint": {REFRESH_TOKEN_TYPE_HINT},
+				"client_id": {"cli"}, "client_secret": {"s3cret"}},
+		},
+	}
+
+	for _, test := range tests {
+		var method, path, contentType string
+		var form url.Values
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, path, contentType = r.Method, r.URL.Path, r.Header.Get("Content-Type")
+			body, _ := ioutil.ReadAll(r.Body)
+			form, _ = url.ParseQuery(string(body))
+			// a successful revocation comes without content
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		oauth, err := NewOAuthClient(context.Background(), server.URL+"/oauth")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = oauth.Logout(test.request)
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if method != http.MethodPost || path != "/oauth/revoke" || contentType != "application/x-www-form-urlencoded" {
+			t.Errorf("%s: got %s %s as '%s', expected a form posted to /oauth/revoke", test.name, method, path, contentType)
+		}
+		if !reflect.DeepEqual(form, test.expected) {
+			t.Errorf("%s: posted %v, expected %v", test.name, form, test.expected)
+		}
+	}
+}
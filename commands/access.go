@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -18,6 +19,13 @@ import (
 	"github.com/urfave/cli"
 )
 
+const (
+	// TOKEN_RENEWAL_WINDOW is how long before its expiry the TA access token gets renewed
+	TOKEN_RENEWAL_WINDOW = 5 * time.Minute
+	// RENEWED_TOKEN_METADATA_KEY is the key of the token renewed by the before action in the metadata of the cli app
+	RENEWED_TOKEN_METADATA_KEY = "renewedToken"
+)
+
 func Login(c *cli.Context) {
 	if !CheckLoginCommandFlags(c) {
 		return
@@ -25,6 +33,8 @@ func Login(c *cli.Context) {
 
 	// settings.PrintPlaceholderValues()
 
+	dropUndecryptableCredentials()
+
 	orgInfo := types.OrgInfo{
 		AccountName: c.String("org"),
 		Region:      c.String("region"),
@@ -35,7 +45,7 @@ func Login(c *cli.Context) {
 	idmServerURL := ""
 	userEmail, err := utils.GetUserEmail()
 	if err != nil || len(userEmail) == 0 {
-		log.Debug(err.Error())
+		log.Debugf("Getting user email failed: %+v", err)
 		utils.CheckError(errors.New("Username is not set."))
 	}
 
@@ -46,11 +56,8 @@ func Login(c *cli.Context) {
 		utils.CheckError(errors.New("TIBCO Accounts URL is not set."))
 	}
 
-	idmServerURL, err = utils.GetIDMConnectURL()
-	if err != nil {
-		log.Debug(err.Error())
-		utils.CheckError(errors.New("Identity-Management Server URL is not set."))
-	}
+	idmServerURL, err = resolveIdmServerURL()
+	utils.CheckError(err)
 
 	if !c.IsSet("username") && !c.IsSet("password") {
 		inputUser = utils.PromptForUser(userEmail)
@@ -85,19 +92,33 @@ func Login(c *cli.Context) {
 	}
 
 	// do login
-	token, err := TaLogin(taURL, inputUser, password)
+	ctx := utils.CommandContext(c)
+	token, err := TaLogin(ctx, taURL, inputUser, password)
 	utils.CheckError(err)
 
-	err = IdmLogin(idmServerURL, inputUser, token.AccessToken, orgInfo, true)
+	err = IdmLogin(ctx, idmServerURL, inputUser, token.AccessToken, orgInfo, true)
 
 	utils.CheckError(err)
 	return
 }
 
+// dropUndecryptableCredentials deletes the session and the token if they can't be decrypted anymore, e.g. as the key
+// file got lost or TASCLI_PASSPHRASE changed, so that logging in again starts from scratch instead of failing on them
+func dropUndecryptableCredentials() {
+	if _, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE); settings.IsUnobfuscateError(err) {
+		log.Debugf("Dropping the session which can't be read: %s", err.Error())
+		DeleteSessionFile()
+	}
+	if _, err := utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE); settings.IsUnobfuscateError(err) {
+		log.Debugf("Dropping the token which can't be read: %s", err.Error())
+		DeleteTokenFile()
+	}
+}
+
 // TaLogin performs login to TIBCO Accounts with username and password
-func TaLogin(url, user, password string) (*types.OAResponse, error) {
+func TaLogin(ctx context.Context, url, user, password string) (*types.OAResponse, error) {
 
-	oauth, err := client.NewOAuthClient(url)
+	oauth, err := client.NewOAuthClient(ctx, url)
 	if err != nil {
 		return nil, err
 	}
@@ -109,33 +130,262 @@ func TaLogin(url, user, password string) (*types.OAResponse, error) {
 
 	resp, err := oauth.Login(types.AuthRequest{Username: user, Pwd: password, ClientId: clientId})
 	if err == nil {
-		token, e := settings.NewToken()
+		storeToken(resp)
+	}
+	return resp, err
+}
+
+// TaRenew exchanges the given refresh token for a new TA access token, persists it and returns it
+func TaRenew(ctx context.Context, url, refreshToken string) (*settings.Token, error) {
+
+	oauth, err := client.NewOAuthClient(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	err, clientId := settings.GetPlaceHolderValue(settings.TIBCO_ACCOUNTS_CLIENTID_PLACEHOLDER)
+	if err != nil {
+		log.Debug(err)
+		return nil, errors.New("TIBCO Accounts' client id not set")
+	}
+
+	resp, err := oauth.Renew(types.FollowupRequest{Token: refreshToken, ClientId: clientId})
+	if err != nil {
+		return nil, err
+	}
+	// TA doesn't always rotate the refresh token, keep using the current one in that case
+	if len(resp.RefreshToken) == 0 {
+		resp.RefreshToken = refreshToken
+	}
+	token := storeToken(resp)
+	if token == nil {
+		return nil, errors.New("Couldn't keep the renewed token")
+	}
+	return token, nil
+}
+
+// storeToken persists the TA access & refresh tokens of the given response to the token file and returns them.
+// Failures are non-fatal, the user will simply have to log in again next time.
+func storeToken(resp *types.OAResponse) *settings.Token {
+	token, e := settings.NewToken()
+	if e != nil {
+		log.Errorf("NON-FATAL: Couldn't create session file for login token: %v", e)
+		return nil
+	}
+
+	// here we keep TA accessToken in a Cookie just want to get benefit of reusing the isValid() func in settingsfile.go which checks the cookie expired or not.
+	token.AccessToken = &http.Cookie{Name: settings.ACCESS_TOKEN_KEY_NAME, Value: resp.AccessToken,
+		Expires: time.Now().UTC().Add(time.Duration(resp.ExpiresIn) * time.Second)}
+	if len(resp.RefreshToken) > 0 {
+		token.RefreshToken = &http.Cookie{Name: settings.REFRESH_TOKEN_KEY_NAME, Value: resp.RefreshToken}
+	}
+
+	if utils.GetEnvParam(consts.DONT_PERSIST) == "" {
+		e = token.Write(consts.OBFUSCATE_COOKIE_VALUE) //obfuscate Token
 		if e != nil {
-			log.Errorf("NON-FATAL: Couldn't create session file for login token: %v", e)
+			log.Errorf("NON-FATAL: Couldn't persist the login token to disk: %v", e)
+		} else {
+			log.Debugf("Persisted the login token to disk.")
 		}
+	} else {
+		log.Infof("No OAuth token persisted since environment variable '%s' is set.", consts.DONT_PERSIST)
+	}
+	return token
+}
 
-		// here we keep TA accessToken in a Cookie just want to get benefit of reusing the isValid() func in settingsfile.go which checks the cookie expired or not.
-		taTokenCookie := &http.Cookie{Name: settings.ACCESS_TOKEN_KEY_NAME, Value: resp.AccessToken, //TODO switch to RefreshToken
-			Expires: time.Now().UTC().Add(time.Duration(resp.ExpiresIn) * time.Second)}
+// RenewToken is the before action of all commands talking to the servers on behalf of the logged-in user. It renews
+// the TA access token before it expires so long-running scripts don't get prompted for password. The command gets
+// the renewed token with loadToken, it may not have been persisted.
+func RenewToken(c *cli.Context) error {
+	token, err := utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		log.Debugf("NON-FATAL: Loading token failed: %+v", err)
+		return nil
+	}
+	keepRenewedToken(c, renewTokenIfNeeded(utils.CommandContext(c), token))
+	return nil
+}
 
-		token.AccessToken = taTokenCookie
+// keepRenewedToken keeps the given token in the metadata of the cli app for loadToken
+func keepRenewedToken(c *cli.Context, token *settings.Token) {
+	if c == nil || c.App == nil {
+		return
+	}
+	if c.App.Metadata == nil {
+		c.App.Metadata = map[string]interface{}{}
+	}
+	c.App.Metadata[RENEWED_TOKEN_METADATA_KEY] = token
+}
 
-		if utils.GetEnvParam(consts.DONT_PERSIST) == "" {
-			e = token.Write(consts.OBFUSCATE_COOKIE_VALUE) //obfuscate Token
-			if e != nil {
-				log.Errorf("NON-FATAL: Couldn't persist the login token to disk: %v", e)
-			} else {
-				log.Debugf("Persisted the login token to disk.")
-			}
-		} else {
-			log.Infof("No OAuth token persisted since environment variable '%s' wasn't set.", consts.DONT_PERSIST)
+// loadToken returns the token renewed by the before action of the command, or the persisted one if none
+func loadToken(c *cli.Context) (*settings.Token, error) {
+	if c != nil && c.App != nil {
+		if token, ok := c.App.Metadata[RENEWED_TOKEN_METADATA_KEY].(*settings.Token); ok {
+			return token, nil
 		}
 	}
-	return resp, err
+	return utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE)
+}
+
+// renewTokenIfNeeded silently renews the TA access token with the stored refresh token when it has expired or
+// is about to expire, and returns the renewed token. Failures are only logged and the given token is returned,
+// the caller falls back to prompting for the password.
+func renewTokenIfNeeded(ctx context.Context, token *settings.Token) *settings.Token {
+	if token.RefreshToken == nil || len(token.RefreshToken.Value) == 0 {
+		return token
+	}
+	if token.AccessToken != nil && (token.AccessToken.Expires.IsZero() ||
+		time.Now().UTC().Add(TOKEN_RENEWAL_WINDOW).Before(token.AccessToken.Expires)) {
+		return token
+	}
+
+	err, taURL := settings.GetPlaceHolderValue(settings.TIBCO_ACCOUNTS_URL_PLACEHOLDER)
+	if err != nil {
+		log.Debug(err.Error())
+		return token
+	}
+
+	log.Debug("TA access token expired or about to expire, renewing it with the refresh token")
+	renewed, err := TaRenew(ctx, taURL, token.RefreshToken.Value)
+	if err != nil {
+		utils.CheckError(ctx.Err())
+		log.Debugf("Renewing access token rejected by TA Server %+v ", err)
+		return token
+	}
+	return renewed
+}
+
+// Logout revokes the TA access token, invalidates the IDM session and wipes the local session and token files
+// (and the profile too if --all is given). Local files are always removed, even when the servers can't be reached;
+// any step that failed is reported once the clean-up is done.
+func Logout(c *cli.Context) {
+	var failures []string
+	ctx := utils.CommandContext(c)
+
+	session, err := settings.NewSession()
+	utils.CheckError(err)
+	if err = session.Read(consts.OBFUSCATE_COOKIE_VALUE); err != nil {
+		log.Debugf("Reading session file failed: %+v", err)
+	}
+	token, err := settings.NewToken()
+	utils.CheckError(err)
+	if err = token.Read(consts.OBFUSCATE_COOKIE_VALUE); err != nil {
+		log.Debugf("Reading token file failed: %+v", err)
+	}
+
+	if len(session.Cookies) > 0 {
+		if err = IdmLogout(ctx); err != nil {
+			utils.CheckError(ctx.Err())
+			log.Debugf("IDM logout failed: %+v", err)
+			failures = append(failures, fmt.Sprintf("Invalidating the Identity-Management session failed: %s", err.Error()))
+		}
+	}
+
+	if token.AccessToken != nil && len(token.AccessToken.Value) > 0 {
+		if err = TaLogout(ctx, client.ACCESS_TOKEN_TYPE_HINT, token.AccessToken.Value); err != nil {
+			utils.CheckError(ctx.Err())
+			log.Debugf("TA logout failed: %+v", err)
+			failures = append(failures, fmt.Sprintf("Revoking the TIBCO Accounts access token failed: %s", err.Error()))
+		}
+	}
+	// the refresh token would otherwise remain usable to get new access tokens
+	if token.RefreshToken != nil && len(token.RefreshToken.Value) > 0 {
+		if err = TaLogout(ctx, client.REFRESH_TOKEN_TYPE_HINT, token.RefreshToken.Value); err != nil {
+			utils.CheckError(ctx.Err())
+			log.Debugf("TA refresh token revocation failed: %+v", err)
+			failures = append(failures, fmt.Sprintf("Revoking the TIBCO Accounts refresh token failed: %s", err.Error()))
+		}
+	}
+
+	if err = session.Delete(); err != nil {
+		failures = append(failures, fmt.Sprintf("Deleting the session file failed: %s", err.Error()))
+	}
+	if err = token.Delete(); err != nil {
+		failures = append(failures, fmt.Sprintf("Deleting the token file failed: %s", err.Error()))
+	}
+	if c.Bool("all") {
+		profile, err := settings.NewProfile()
+		utils.CheckError(err)
+		if err = profile.Delete(); err != nil {
+			failures = append(failures, fmt.Sprintf("Deleting the profile file failed: %s", err.Error()))
+		}
+	}
+
+	if len(failures) > 0 {
+		fmt.Println("Logout completed with errors:")
+		for _, failure := range failures {
+			fmt.Println("  - " + failure)
+		}
+		utils.CheckError(errors.New("User may still be logged in on the server side."))
+	}
+	fmt.Println("User is logged out.")
+}
+
+// TaLogout revokes the given access or refresh token, as told by tokenTypeHint, at TIBCO Accounts
+func TaLogout(ctx context.Context, tokenTypeHint, token string) error {
+	err, taURL := settings.GetPlaceHolderValue(settings.TIBCO_ACCOUNTS_URL_PLACEHOLDER)
+	if err != nil {
+		log.Debug(err.Error())
+		return errors.New("TIBCO Accounts URL is not set.")
+	}
+	err, clientId := settings.GetPlaceHolderValue(settings.TIBCO_ACCOUNTS_CLIENTID_PLACEHOLDER)
+	if err != nil {
+		log.Debug(err.Error())
+		return errors.New("TIBCO Accounts' client id not set")
+	}
+
+	oauth, err := client.NewOAuthClient(ctx, taURL)
+	if err != nil {
+		return err
+	}
+	_, err = oauth.Logout(types.FollowupRequest{Token: token, ClientId: clientId, TokenTypeHint: tokenTypeHint})
+	return err
+}
+
+// IdmLogout invalidates the session cookies of the current user on the Identity-Management server
+func IdmLogout(ctx context.Context) error {
+	// log out of the regional IDM server the session belongs to, if known
+	var idmServerURL string
+	if session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE); err == nil {
+		idmServerURL = session.IdmUrl
+	}
+	if len(idmServerURL) == 0 {
+		var err error
+		if idmServerURL, err = resolveIdmServerURL(); err != nil {
+			return err
+		}
+	}
+
+	parsedURL, err := url.Parse(idmServerURL)
+	if err != nil {
+		return err
+	}
+	parsedURL.Path = utils.GetIdentityManagementLogoutAPI()
+
+	log.Debugf("Sending IDM logout against url: '%s'", parsedURL.String())
+
+	response, err := utils.RestCallAndCookiesRefreshHandler(
+		&types.RestCallRequest{
+			Context:      ctx,
+			Service:      "Identity-Management",
+			Url:          parsedURL,
+			Headers:      map[string]string{"Content-Type": "application/json"},
+			Method:       http.MethodPost,
+			Body:         nil,
+			LogRequest:   false,
+			UserId:       "",
+			RetryAttempt: utils.GetRetryAttempt(),
+		})
+	if err != nil {
+		return err
+	}
+	if response.ErrorResponse != nil {
+		return errors.New(response.ErrorResponse.ErrorMsg)
+	}
+	return nil
 }
 
 // IsValidPlatformApi validates cli version against platform api by accessing /platformapiversion
-func IsValidPlatformApi() (bool, error) {
+func IsValidPlatformApi(ctx context.Context) (bool, error) {
 
 	domainUrl, err := utils.GetDomainURL()
 	if err != nil {
@@ -154,10 +404,11 @@ func IsValidPlatformApi() (bool, error) {
 
 	noRedirectMarker := errors.New("my-redirect-marker")
 
-	httpClient := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+	httpClient := utils.NewHTTPClient(nil)
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		return noRedirectMarker
-	}}
-	request, err := http.NewRequest("GET", tccUrlForPlatformVersion, nil)
+	}
+	request, err := http.NewRequestWithContext(ctx, "GET", tccUrlForPlatformVersion, nil)
 	if err != nil {
 		log.Debugf("GET '%s' failed with error: %s", tccUrlForPlatformVersion, err.Error())
 		return false, err
@@ -166,7 +417,7 @@ func IsValidPlatformApi() (bool, error) {
 	resp, err := httpClient.Do(request)
 	if err != nil && !strings.Contains(err.Error(), noRedirectMarker.Error()) {
 		log.Debugf("Request '%+v' failed with error: %s", request, err.Error())
-		return false, err
+		return false, utils.CheckTimeout(ctx, err, "Domain Server")
 	}
 	defer resp.Body.Close()
 
@@ -205,7 +456,9 @@ func CheckPlatformVersionAndLogin(c *cli.Context) error {
 
 	log.Debug("Validate tibcli version and check login...")
 
-	if isValid, err := IsValidPlatformApi(); err != nil {
+	ctx := utils.CommandContext(c)
+	if isValid, err := IsValidPlatformApi(ctx); err != nil {
+		utils.CheckError(ctx.Err())
 		if strings.Contains(err.Error(), "Session.orgList") {
 			DeleteSessionFile()
 			DeleteTokenFile()
@@ -220,34 +473,44 @@ func CheckPlatformVersionAndLogin(c *cli.Context) error {
 	return checkLogin(c)
 }
 
+// loadSettingsOrStartOver loads the profile, session and token, settings written by older tibcli versions get
+// migrated on read. If they can't be migrated (e.g. written by a newer tibcli) then all of them are wiped out
+// to start from scratch.
+func loadSettingsOrStartOver() (*settings.Profile, *settings.Session, *settings.Token, error) {
+	profile, session, token, err := utils.LoadSettings()
+	if _, ok := err.(*settings.MigrationError); ok {
+		log.Debugf("%s Starting from scratch.", err.Error())
+
+		DeleteProfile()
+		DeleteSessionFile()
+		DeleteTokenFile()
+
+		profile, session, token, err = utils.LoadSettings()
+	}
+	return profile, session, token, err
+}
+
 //ensure user is logged in
 func checkLogin(c *cli.Context) error {
+	ctx := utils.CommandContext(c)
 
 	//check that branded values in tibcli, including domainURL match saved local profile
-	profile, session, token, err := utils.LoadSettings()
+	profile, session, token, err := loadSettingsOrStartOver()
 	utils.CheckError(err)
 
-	// if 'old-style' profile doesn't have version field or version field has wrong version number then wipe out all profile/session/token and start from scratch
 	if profile.Version != consts.CLI_VERSION {
-
-		utils.CheckError(profile.Delete())
-		utils.CheckError(session.Delete())
-		utils.CheckError(token.Delete())
-
-		session, err = utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
-		utils.CheckError(err)
-		profile, err = utils.LoadProfile()
-		utils.CheckError(err)
-		token, err = utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE)
-		utils.CheckError(err)
+		log.Debugf("Profile written by tibcli '%s', updating it to '%s'", profile.Version, consts.CLI_VERSION)
+		profile.Version = consts.CLI_VERSION
+		utils.CheckError(profile.Write())
 	}
 
-	// get idm server url from placeholder
-	err, idmServerURL := settings.GetPlaceHolderValue(settings.IDENTITY_MANAGEMENT_SERVER_HOST_PLACEHOLDER)
-	if err != nil || len(idmServerURL) == 0 {
-		log.Debug(err.Error())
-		utils.CheckError(errors.New("Identity-Management Server URL is not set via placeholder."))
-	}
+	// renew the TA access token before it expires so long-running scripts don't get prompted for password
+	token = renewTokenIfNeeded(ctx, token)
+	keepRenewedToken(c, token)
+
+	// get idm server url, the --idm-url flag and TASCLI_IDM_URL take precedence over the profile
+	idmServerURL, err := resolveIdmServerURL()
+	utils.CheckError(err)
 
 	// get user email from placeholder
 	err, userEmail := settings.GetPlaceHolderValue(settings.USERNAME_PLACEHOLDER)
@@ -262,26 +525,18 @@ func checkLogin(c *cli.Context) error {
 		userEmail = profile.UserEmail
 	}
 
-	// check idm server url in profile
-	if len(profile.IDMConnectURL) > 0 && profile.IDMConnectURL != idmServerURL {
-		log.Debugf("profile.idmServerUrl: %s, idm server URL read from placeholder is: %s", profile.IDMConnectURL, idmServerURL)
-		idmServerURL = profile.IDMConnectURL
-	}
-
 	//we may prompt user here for password only if this is NOT the login command.  That command does prompt on its own
 	promptForPassword := c.Command.Name != "login"
 
-	isSessionValid := CheckCookiesIsValid(session.Cookies, settings.SESSION_FILENAME)
+	isSessionValid := CheckCookiesIsValid(ctx, session.Cookies, settings.SESSION_FILENAME)
+	utils.CheckError(ctx.Err())
 	log.Debugf("session cookies is valid ? : '%+v'", isSessionValid)
 
 	// check cookies of session are still-valid or not
 	if !isSessionValid {
 		log.Debug("session cookies get expired")
-		// load TA access token
-		loadedAccessToken, er := utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE)
-		utils.CheckError(er)
-
-		if CheckCookiesIsValid([]*http.Cookie{loadedAccessToken.AccessToken}, settings.TOKEN_FILE_NAME) {
+		// the TA access token, as renewed above, may not have been persisted
+		if CheckCookiesIsValid(ctx, []*http.Cookie{token.AccessToken}, settings.TOKEN_FILE_NAME) {
 			log.Debug("Session cookies missing or expired, trying still-valid access token")
 
 			// Login to IDM again to refresh session with the still-valid TA access token
@@ -290,7 +545,7 @@ func checkLogin(c *cli.Context) error {
 				AccountName: c.String("org"),
 				Region:      c.String("region"),
 			}
-			err = IdmLogin(idmServerURL, userEmail, loadedAccessToken.AccessToken.Value, orgInfo, false)
+			err = IdmLogin(ctx, idmServerURL, userEmail, token.AccessToken.Value, orgInfo, false)
 			if err != nil {
 				log.Debugf("Refresh session rejected by IDM Server %+v ", err)
 				utils.CheckError(err)
@@ -316,14 +571,14 @@ func checkLogin(c *cli.Context) error {
 			password := utils.PromptForPassword()
 
 			// Do TA login
-			accessToken, err := TaLogin(taURL, userEmail, password)
+			accessToken, err := TaLogin(ctx, taURL, userEmail, password)
 			if err != nil {
 				log.Debugf("Refresh accessToken rejected by TA Server %+v ", err)
 				utils.CheckError(err)
 				return err
 			}
 			// Do IDM login
-			err = IdmLogin(idmServerURL, userEmail, accessToken.AccessToken, types.OrgInfo{}, true)
+			err = IdmLogin(ctx, idmServerURL, userEmail, accessToken.AccessToken, types.OrgInfo{}, true)
 			if err != nil {
 				log.Debugf("Refresh session rejected by IDM Server %+v ", err)
 				utils.CheckError(err)
@@ -348,7 +603,7 @@ func CheckLoginCommandFlags(c *cli.Context) bool {
 }
 
 // CheckCookiesIsValid checks all cookies are valid/expired
-func CheckCookiesIsValid(cookies []*http.Cookie, fileName string) bool {
+func CheckCookiesIsValid(ctx context.Context, cookies []*http.Cookie, fileName string) bool {
 	if cookies == nil || len(cookies) == 0 {
 		log.Debug("Cookies of session file are empty")
 		return false
@@ -366,14 +621,14 @@ func CheckCookiesIsValid(cookies []*http.Cookie, fileName string) bool {
 		}
 	} else if fileName == settings.SESSION_FILENAME { // cookies in session file are coming from IDM which don't have 'Expires' field so we need another way to test they are valid or not
 		// we use the get default sandbox call on domain server to check if the cookies
-		dsClient, err := client.NewDomainServer()
+		dsClient, err := client.NewDomainServer(ctx)
 		if err != nil {
 			log.Errorf("Initializing DomainServer client instance on error: %s", err.Error())
 			return false
 		}
-		_, httpCode, err := dsClient.GetDefaultSandbox()
+		_, _, err = dsClient.GetDefaultSandbox()
 		if err != nil {
-			if httpCode == 599 && strings.Contains(err.Error(), "419") { // the backend code set 599 code in the response httpCode and the 419 code can be found from error msg
+			if client.IsSessionExpired(err) {
 				log.Debugf("Cookies in session file get invalid as we got 419 error while accessing backend: %s", err.Error())
 			} else {
 				log.Debugf("Validating session cookies failed on errors other then 419: %s", err.Error())
@@ -0,0 +1,558 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/types"
+	"github.com/Morphyni/tas-cli/utils"
+	"github.com/urfave/cli"
+)
+
+const (
+	testUser          = "jack@example.com"
+	testPassword      = "s3cret-password"
+	testClientId      = "test-client-id"
+	testAccessToken   = "ta-access-token-value"
+	testRefreshToken  = "ta-refresh-token-value"
+	testSessionCookie = "idm-session-cookie-value"
+	testTAPath        = "/oauth/token"
+)
+
+// testSettingsDir is the settings directory of all tests, it can't change as the settings package caches it
+var testSettingsDir string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "tas-cli-commands-test")
+	if err != nil {
+		panic(err)
+	}
+	testSettingsDir = dir
+	if err = settings.SetSettingsDir(dir); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// resetSettings wipes whatever a previous test left in the settings directory, but the key
+func resetSettings(t *testing.T) {
+	entries, err := ioutil.ReadDir(testSettingsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != settings.KEY_FILENAME {
+			if err = os.RemoveAll(path.Join(testSettingsDir, entry.Name())); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// setEnv sets the given environment variables and returns the function restoring them
+func setEnv(values map[string]string) func() {
+	previous := map[string]string{}
+	for name, value := range values {
+		previous[name] = os.Getenv(name)
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, value := range previous {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+// recordedRequest is what the fake server got, in order
+type recordedRequest struct {
+	Method        string
+	Path          string
+	Authorization string
+	Cookie        string
+	Form          url.Values
+	Body          string
+}
+
+// fakeServer plays TIBCO Accounts, Identity-Management and the Domain Server, recording the requests it gets
+type fakeServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []recordedRequest
+	handlers map[string]http.HandlerFunc
+}
+
+// newFakeServer starts a fake server answering the TA & IDM login and the Domain Server default sandbox requests
+func newFakeServer(t *testing.T) *fakeServer {
+	fs := &fakeServer{handlers: map[string]http.HandlerFunc{}}
+	fs.Server = httptest.NewServer(http.HandlerFunc(fs.serve))
+
+	fs.handlers["/platformapiversion"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(consts.CLI_VERSION))
+	}
+	fs.handlers[testTAPath] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.OAResponse{AccessToken: testAccessToken, RefreshToken: testRefreshToken, ExpiresIn: 3600})
+	}
+	fs.handlers[utils.GetIdentityManagementLoginAPI()] = func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "idm-session", Value: testSessionCookie, Path: "/"})
+		writeJSON(t, w, types.IDMLoginResponse{
+			FirstName:      "Jack",
+			UserName:       testUser,
+			OrgName:        "acme",
+			OrgDisplayName: "Acme",
+			DomainUrl:      fs.URL,
+			OrgList:        []types.OrgEntry{{Name: "acme", DisplayName: "Acme", SubscriptionId: "sub-1"}},
+		})
+	}
+	fs.handlers[utils.GetDomainServerDefaultSandboxAPI()] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.DomainServerSandboxBean{Id: "sbx-1", SandboxName: consts.DEFAULT_SANDBOX, OrganizationId: "org-1"})
+	}
+	return fs
+}
+
+func (fs *fakeServer) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	recorded := recordedRequest{
+		Method:        r.Method,
+		Path:          r.URL.EscapedPath(),
+		Authorization: r.Header.Get("Authorization"),
+		Cookie:        r.Header.Get("Cookie"),
+		Body:          string(body),
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		recorded.Form, _ = url.ParseQuery(string(body))
+	}
+	fs.lock.Lock()
+	fs.requests = append(fs.requests, recorded)
+	handler, ok := fs.handlers[r.URL.EscapedPath()]
+	fs.lock.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errorCode":"404","errorMsg":"Not found"}`))
+		return
+	}
+	handler(w, r)
+}
+
+// paths returns the method & path of the requests got so far
+func (fs *fakeServer) paths() []string {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	paths := make([]string, len(fs.requests))
+	for i, request := range fs.requests {
+		paths[i] = request.Method + " " + request.Path
+	}
+	return paths
+}
+
+// request returns the first request got on the given path
+func (fs *fakeServer) request(t *testing.T, path string) recordedRequest {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	for _, request := range fs.requests {
+		if request.Path == path {
+			return request
+		}
+	}
+	t.Fatalf("No request on '%s', got: %v", path, fs.requests)
+	return recordedRequest{}
+}
+
+// env returns the environment pointing tas-cli to the fake server
+func (fs *fakeServer) env() map[string]string {
+	return map[string]string{
+		"TASCLI_USERNAME":   testUser,
+		"TASCLI_TA_URL":     fs.URL + testTAPath,
+		"TASCLI_CLIENT_ID":  testClientId,
+		"TASCLI_IDM_URL":    fs.URL,
+		"TASCLI_DOMAIN_URL": fs.URL,
+		consts.DONT_PERSIST: "",
+	}
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Error(err)
+	}
+}
+
+// runCommand runs the given command line, commands exit the process on error so the test fails if so
+func runCommand(t *testing.T, commands []cli.Command, args ...string) {
+	app := cli.NewApp()
+	app.Commands = commands
+	utils.SetCommandContext(app, context.Background())
+	if err := app.Run(append([]string{consts.CLI_MODULE_NAME}, args...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var loginCommand = cli.Command{
+	Name: "login",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "username, u"},
+		cli.StringFlag{Name: "password, p"},
+		cli.StringFlag{Name: "org, o"},
+		cli.StringFlag{Name: "region, r"},
+	},
+	Action: func(c *cli.Context) {
+		Login(c)
+	},
+}
+
+// readRaw returns the raw content of the given settings file
+func readRaw(t *testing.T, filename string) string {
+	bytes, err := ioutil.ReadFile(path.Join(testSettingsDir, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bytes)
+}
+
+// writeRaw replaces the content of the given settings file
+func writeRaw(t *testing.T, filename, content string) {
+	if err := ioutil.WriteFile(path.Join(testSettingsDir, filename), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginSequence(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+
+	expected := []string{
+		"GET /platformapiversion",
+		"POST " + testTAPath,
+		"POST " + utils.GetIdentityManagementLoginAPI(),
+		"GET " + utils.GetDomainServerDefaultSandboxAPI(),
+	}
+	if !reflect.DeepEqual(server.paths(), expected) {
+		t.Fatalf("Requests %v, expected %v", server.paths(), expected)
+	}
+
+	taRequest := server.request(t, testTAPath)
+	expectedForm := url.Values{
+		"grant_type": {"password"},
+		"client_id":  {testClientId},
+		"username":   {testUser},
+		"password":   {testPassword},
+	}
+	if !reflect.DeepEqual(taRequest.Form, expectedForm) {
+		t.Errorf("TA login form %v, expected %v", taRequest.Form, expectedForm)
+	}
+
+	idmRequest := server.request(t, utils.GetIdentityManagementLoginAPI())
+	if idmRequest.Authorization != "Bearer "+testAccessToken {
+		t.Errorf("IDM login authorization '%s', expected the TA access token", idmRequest.Authorization)
+	}
+
+	sandboxRequest := server.request(t, utils.GetDomainServerDefaultSandboxAPI())
+	if !strings.Contains(sandboxRequest.Cookie, "idm-session="+testSessionCookie) {
+		t.Errorf("Domain Server request cookies '%s', expected the IDM session cookie", sandboxRequest.Cookie)
+	}
+
+	// token & session are encrypted at rest
+	rawToken := readRaw(t, settings.TOKEN_FILE_NAME)
+	rawSession := readRaw(t, settings.SESSION_FILENAME)
+	for _, secret := range []string{testAccessToken, testRefreshToken} {
+		if strings.Contains(rawToken, secret) {
+			t.Errorf("Token file holds '%s' in clear: %s", secret, rawToken)
+		}
+	}
+	if strings.Contains(rawSession, testSessionCookie) {
+		t.Errorf("Session file holds the session cookie in clear: %s", rawSession)
+	}
+	if !strings.Contains(rawToken, settings.OBFUS_PREFIX) || !strings.Contains(rawSession, settings.OBFUS_PREFIX) {
+		t.Errorf("Token and session values aren't obfuscated with '%s'", settings.OBFUS_PREFIX)
+	}
+
+	token, err := utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken == nil || token.AccessToken.Value != testAccessToken {
+		t.Errorf("Access token %+v, expected '%s'", token.AccessToken, testAccessToken)
+	}
+	if token.RefreshToken == nil || token.RefreshToken.Value != testRefreshToken {
+		t.Errorf("Refresh token %+v, expected '%s'", token.RefreshToken, testRefreshToken)
+	}
+
+	session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Cookies) != 1 || session.Cookies[0].Value != testSessionCookie {
+		t.Errorf("Session cookies %+v, expected the IDM session cookie", session.Cookies)
+	}
+	if session.UserName != testUser || session.OrgName != "acme" || session.SubscriptionId != "sub-1" {
+		t.Errorf("Session %+v doesn't hold the IDM login response", session)
+	}
+	if session.DefaultSandboxName != consts.DEFAULT_SANDBOX {
+		t.Errorf("Default sandbox '%s', expected '%s'", session.DefaultSandboxName, consts.DEFAULT_SANDBOX)
+	}
+}
+
+// as if the key file got lost or TASCLI_PASSPHRASE changed since the last login
+func TestLoginDropsUndecryptableCredentials(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	undecryptable := settings.OBFUS_PREFIX + "c2VhbGVkIHdpdGggYW5vdGhlciBrZXkgZm9yIHN1cmU"
+	writeRaw(t, settings.TOKEN_FILE_NAME, `{"AccessToken":{"Name":"AccessToken","Value":"`+undecryptable+`"},"schemaVersion":2}`)
+	writeRaw(t, settings.SESSION_FILENAME, `{"cookies":[{"Name":"idm-session","Value":"`+undecryptable+`"}],"schemaVersion":2}`)
+	if _, err := utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE); !settings.IsUnobfuscateError(err) {
+		t.Fatalf("Loading the token gave '%v', expected an UnobfuscateError", err)
+	}
+
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+
+	token, err := utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken == nil || token.AccessToken.Value != testAccessToken {
+		t.Errorf("Access token %+v, expected the one of the new login", token.AccessToken)
+	}
+	session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Cookies) != 1 || session.Cookies[0].Value != testSessionCookie {
+		t.Errorf("Session cookies %+v, expected the ones of the new login", session.Cookies)
+	}
+}
+
+func TestStartOverOnMigrationError(t *testing.T) {
+	resetSettings(t)
+
+	// a session written by a newer tibcli, along with a profile and token this one understands
+	writeRaw(t, settings.PROFILE_FILENAME, `{"tibcliVersion":"99.0.0","userEmail":"`+testUser+`","schemaVersion":2}`)
+	writeRaw(t, settings.SESSION_FILENAME, `{"cookies":[],"orgName":"acme","schemaVersion":99}`)
+	writeRaw(t, settings.TOKEN_FILE_NAME, `{"AccessToken":{"Name":"AccessToken","Value":"plain"},"schemaVersion":2}`)
+
+	profile, session, token, err := loadSettingsOrStartOver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.UserEmail != "" || session.OrgName != "" || token.AccessToken != nil {
+		t.Errorf("Loaded profile %+v, session %+v and token %+v, expected empty ones", profile, session, token)
+	}
+	for _, filename := range []string{settings.PROFILE_FILENAME, settings.SESSION_FILENAME, settings.TOKEN_FILE_NAME} {
+		if _, err := os.Stat(path.Join(testSettingsDir, filename)); !os.IsNotExist(err) {
+			t.Errorf("'%s' wasn't deleted: %v", filename, err)
+		}
+	}
+}
+
+func TestLoginUsesConfiguredIdmServer(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	// without --idm-url nor TASCLI_IDM_URL
+	env := server.env()
+	env["TASCLI_IDM_URL"] = ""
+	defer setEnv(env)()
+
+	// as set with 'config set idmConnectUrl' & 'config set userEmail'
+	profile, err := settings.NewProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.IDMConnectURL = server.URL
+	profile.UserEmail = "configured@example.com"
+	if err = profile.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+
+	server.request(t, utils.GetIdentityManagementLoginAPI())
+	profile, err = utils.LoadProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.IDMConnectURL != server.URL || profile.UserEmail != "configured@example.com" {
+		t.Errorf("Login overwrote the configured IDM server '%s' and user '%s'", profile.IDMConnectURL, profile.UserEmail)
+	}
+}
+
+func TestIdmServerPrecedence(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	env := server.env()
+	env["TASCLI_IDM_URL"] = ""
+	defer setEnv(env)()
+
+	profile, err := settings.NewProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.IDMConnectURL = "https://profile.example.com"
+	if err = profile.Write(); err != nil {
+		t.Fatal(err)
+	}
+	defer settings.SetPlaceHolderFlag(settings.IDENTITY_MANAGEMENT_SERVER_HOST_PLACEHOLDER, "")
+
+	tests := []struct {
+		name     string
+		flag     string
+		env      string
+		expected string
+	}{
+		{name: "profile", expected: "https://profile.example.com"},
+		{name: "environment", env: "https://env.example.com", expected: "https://env.example.com"},
+		{name: "flag", flag: "https://flag.example.com", env: "https://env.example.com", expected: "https://flag.example.com"},
+	}
+	for _, test := range tests {
+		settings.SetPlaceHolderFlag(settings.IDENTITY_MANAGEMENT_SERVER_HOST_PLACEHOLDER, test.flag)
+		restore := setEnv(map[string]string{"TASCLI_IDM_URL": test.env})
+		idmServerURL, err := resolveIdmServerURL()
+		restore()
+		if err != nil || idmServerURL != test.expected {
+			t.Errorf("%s: resolved '%s', %v, expected '%s'", test.name, idmServerURL, err, test.expected)
+		}
+	}
+}
+
+func TestMultiOrgLoginKeepsRegionalIdmServerInSession(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	regional := newFakeServer(t)
+	defer regional.Close()
+	defer setEnv(server.env())()
+
+	// the global IDM server lists the user's organizations along with the IDM server of each region
+	server.handlers[utils.GetIdentityManagementLoginAPI()] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.MultiSubscriptionLoginResponse{Accounts: []types.AccountsInfo{
+			{AccountId: "acme", AccountDisplayName: "Acme", SubscriptionId: "sub-1", RegionToUrls: []types.RegionUrlInfo{
+				{Region: "us-west", Url: "https://us.example.com"},
+				{Region: "eu-west", Url: regional.URL},
+			}},
+			{AccountId: "other", AccountDisplayName: "Other", SubscriptionId: "sub-2", RegionToUrls: []types.RegionUrlInfo{
+				{Region: "us-west", Url: "https://us.example.com"},
+			}},
+		}})
+	}
+
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword, "-o", "Acme", "-r", "eu-west")
+
+	regional.request(t, utils.GetIdentityManagementLoginAPI())
+	profile, err := utils.LoadProfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.IDMConnectURL != server.URL {
+		t.Errorf("Profile got the IDM server '%s', expected the global one '%s'", profile.IDMConnectURL, server.URL)
+	}
+	session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.IdmUrl != regional.URL {
+		t.Errorf("Session got the IDM server '%s', expected the regional one '%s'", session.IdmUrl, regional.URL)
+	}
+
+	// the IDM server given with --idm-url is used over the one recorded in the profile, when the expired session is
+	// renewed with the still-valid access token
+	DeleteSessionFile()
+	flagged := newFakeServer(t)
+	defer flagged.Close()
+	server.lock.Lock()
+	server.requests = nil
+	server.lock.Unlock()
+	settings.SetPlaceHolderFlag(settings.IDENTITY_MANAGEMENT_SERVER_HOST_PLACEHOLDER, flagged.URL)
+	defer settings.SetPlaceHolderFlag(settings.IDENTITY_MANAGEMENT_SERVER_HOST_PLACEHOLDER, "")
+
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+
+	flagged.request(t, utils.GetIdentityManagementLoginAPI())
+	for _, path := range server.paths() {
+		if path == "POST "+utils.GetIdentityManagementLoginAPI() {
+			t.Errorf("IDM session renewed against the server of the profile, expected the one of --idm-url")
+		}
+	}
+	if session, err = utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE); err != nil || session.IdmUrl != flagged.URL {
+		t.Errorf("Session got the IDM server '%s', %v, expected '%s'", session.IdmUrl, err, flagged.URL)
+	}
+}
+
+func TestRenewTokenWithoutPersisting(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+
+	// the access token expired since the login
+	token, err := utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.AccessToken.Expires = time.Now().UTC().Add(-time.Minute)
+	if err = token.Write(consts.OBFUSCATE_COOKIE_VALUE); err != nil {
+		t.Fatal(err)
+	}
+	server.handlers[testTAPath] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.OAResponse{AccessToken: "renewed-access-token", ExpiresIn: 3600})
+	}
+	defer setEnv(map[string]string{consts.DONT_PERSIST: "true"})()
+
+	whoamiCommand := cli.Command{
+		Name:   "whoami",
+		Flags:  []cli.Flag{cli.StringFlag{Name: "output", Value: "text"}},
+		Before: RenewToken,
+		Action: func(c *cli.Context) {
+			Whoami(c)
+		},
+	}
+	output := captureStdout(t, func() {
+		runCommand(t, []cli.Command{whoamiCommand}, "whoami", "--output", "json")
+	})
+
+	var id identity
+	if err = json.Unmarshal([]byte(output), &id); err != nil {
+		t.Fatalf("Output isn't JSON: %v\n%s", err, output)
+	}
+	if !id.TokenValid || !id.TokenExpires.After(time.Now()) {
+		t.Errorf("Displayed token valid %t until %v, expected the renewed token", id.TokenValid, id.TokenExpires)
+	}
+	renewed := false
+	for _, request := range server.requests {
+		renewed = renewed || request.Path == testTAPath && request.Form.Get("refresh_token") == testRefreshToken
+	}
+	if !renewed {
+		t.Errorf("No renewal with the refresh token, got %v", server.paths())
+	}
+
+	// nothing got persisted, the expired token is still on disk
+	persisted, err := utils.LoadToken(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if persisted.AccessToken.Value != testAccessToken {
+		t.Errorf("Persisted access token '%s', expected the expired one", persisted.AccessToken.Value)
+	}
+}
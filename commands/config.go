@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/utils"
+	"github.com/urfave/cli"
+)
+
+// ShowConfig prints the value of every placeholder and the layer (placeholder, config file, environment, flag) it
+// comes from. The client id is masked.
+func ShowConfig(c *cli.Context) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVALUE\tSOURCE")
+	for placeholderType := range settings.PLACEHOLDER_NAMES {
+		resolution := settings.ResolvePlaceHolder(placeholderType)
+		value := resolution.Value
+		if resolution.Err != nil {
+			value = "<not set>"
+		} else if placeholderType == settings.TIBCO_ACCOUNTS_CLIENTID_PLACEHOLDER {
+			value = maskSecret(value)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", settings.PLACEHOLDER_CONFIG_KEYS[placeholderType], value, resolution.Source)
+	}
+	w.Flush()
+}
+
+// maskSecret keeps only the first characters of the given secret, enough to tell which one it is
+func maskSecret(secret string) string {
+	if len(secret) <= 4 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", len(secret)-4)
+}
+
+// ListConfig prints all user-level settings kept in the profile with their values
+func ListConfig(c *cli.Context) {
+	profile, err := utils.LoadProfile()
+	utils.CheckError(err)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tDESCRIPTION")
+	for i := range settings.CONFIG_KEYS {
+		key := &settings.CONFIG_KEYS[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key.Name, key.Get(profile), key.Description)
+	}
+	w.Flush()
+}
+
+// GetConfig prints the value of the given user-level setting
+func GetConfig(c *cli.Context) {
+	if c.NArg() != 1 {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: "Please provide the config key."})
+	}
+	key, err := settings.GetConfigKey(c.Args().First())
+	utils.CheckError(err)
+	profile, err := utils.LoadProfile()
+	utils.CheckError(err)
+
+	fmt.Println(key.Get(profile))
+}
+
+// SetConfig validates and saves the given value of the given user-level setting
+func SetConfig(c *cli.Context) {
+	if c.NArg() != 2 {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: "Please provide the config key and its value."})
+	}
+	key, err := settings.GetConfigKey(c.Args().Get(0))
+	utils.CheckError(err)
+	profile, err := utils.LoadProfile()
+	utils.CheckError(err)
+
+	previous := key.Get(profile)
+	utils.CheckError(key.Set(profile, c.Args().Get(1)))
+	utils.CheckError(profile.Write())
+	utils.CheckError(key.Apply(profile, previous))
+}
+
+// UnsetConfig clears the given user-level setting
+func UnsetConfig(c *cli.Context) {
+	if c.NArg() != 1 {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: "Please provide the config key."})
+	}
+	key, err := settings.GetConfigKey(c.Args().First())
+	utils.CheckError(err)
+	profile, err := utils.LoadProfile()
+	utils.CheckError(err)
+
+	previous := key.Get(profile)
+	key.Unset(profile)
+	utils.CheckError(profile.Write())
+	utils.CheckError(key.Apply(profile, previous))
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/utils"
+	"github.com/urfave/cli"
+)
+
+// ListContexts prints all contexts, marking the one in use
+func ListContexts(c *cli.Context) {
+	names, err := settings.ListContexts()
+	utils.CheckError(err)
+
+	current := settings.GetContext()
+	for _, name := range names {
+		if name == current {
+			fmt.Println("* " + name)
+		} else {
+			fmt.Println("  " + name)
+		}
+	}
+}
+
+// UseContext makes the given context the one used by the following commands
+func UseContext(c *cli.Context) {
+	if c.NArg() != 1 {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: "Please provide the name of the context to use."})
+	}
+	name := c.Args().First()
+	utils.CheckError(settings.UseContext(name))
+	fmt.Printf("Switched to context '%s'.\n", name)
+}
+
+// DeleteContext deletes the given context along with its profile, session and token
+func DeleteContext(c *cli.Context) {
+	if c.NArg() != 1 {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: "Please provide the name of the context to delete."})
+	}
+	name := c.Args().First()
+	utils.CheckError(settings.DeleteContext(name))
+	fmt.Printf("Context '%s' deleted.\n", name)
+}
@@ -0,0 +1,326 @@
+package commands
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/utils"
+	"github.com/urfave/cli"
+)
+
+// Statuses of the doctor checks
+const (
+	CHECK_PASS string = "pass"
+	CHECK_WARN string = "warn"
+	CHECK_FAIL string = "fail"
+)
+
+const (
+	// DOCTOR_DIAL_TIMEOUT bounds each connectivity check
+	DOCTOR_DIAL_TIMEOUT = 10 * time.Second
+	// CLOCK_SKEW_WARN_THRESHOLD is the clock difference with the server from which a warning is reported,
+	// token expiries are computed locally
+	CLOCK_SKEW_WARN_THRESHOLD = 30 * time.Second
+	// CLOCK_SKEW_FAIL_THRESHOLD is the clock difference with the server from which the check fails
+	CLOCK_SKEW_FAIL_THRESHOLD = 5 * time.Minute
+)
+
+// checkResult is the outcome of one doctor check
+type checkResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Doctor diagnoses the configuration and the connectivity to the servers, printing a pass/warn/fail report
+// (as JSON with --output json). It exits with an error if any check failed.
+func Doctor(c *cli.Context) {
+	output := c.String("output")
+	if output != "text" && output != "json" {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: fmt.Sprintf("Unknown output format '%s', use 'text' or 'json'.", output)})
+	}
+
+	var results []checkResult
+	results = append(results, checkPlaceholders()...)
+	results = append(results, checkSettingsDir())
+
+	taURL := ""
+	if err, value := settings.GetPlaceHolderValue(settings.TIBCO_ACCOUNTS_URL_PLACEHOLDER); err == nil {
+		taURL = value
+	}
+	idmServerURL, _ := resolveIdmServerURL()
+	domainURL, _ := utils.GetDomainURL()
+	ctx := utils.CommandContext(c)
+	results = append(results,
+		checkReachability(ctx, "TIBCO Accounts", taURL),
+		checkReachability(ctx, "Identity-Management", idmServerURL),
+		checkReachability(ctx, "Domain Server", domainURL),
+		checkPlatformApi(ctx),
+		checkClockSkew(ctx, domainURL),
+	)
+	results = append(results, checkLoginState(ctx)...)
+	utils.CheckError(ctx.Err())
+
+	failed := false
+	for _, result := range results {
+		failed = failed || result.Status == CHECK_FAIL
+	}
+
+	if output == "json" {
+		bytes, err := json.MarshalIndent(results, "", "  ")
+		utils.CheckError(err)
+		fmt.Println(string(bytes))
+	} else {
+		for _, result := range results {
+			fmt.Printf("[%s] %s: %s\n", result.Status, result.Name, result.Detail)
+		}
+	}
+	if failed {
+		utils.CheckError(errors.New("Some checks failed."))
+	}
+}
+
+// checkPlaceholders checks every placeholder is set, whatever layer it comes from
+func checkPlaceholders() []checkResult {
+	var results []checkResult
+	for placeholderType := range settings.PLACEHOLDER_NAMES {
+		resolution := settings.ResolvePlaceHolder(placeholderType)
+		result := checkResult{Name: "Placeholder " + settings.PLACEHOLDER_CONFIG_KEYS[placeholderType]}
+		switch {
+		case resolution.Err != nil && isRequiredPlaceholder(placeholderType):
+			result.Status, result.Detail = CHECK_FAIL, resolution.Err.Error()
+		case resolution.Err != nil:
+			result.Status, result.Detail = CHECK_WARN, resolution.Err.Error()
+		default:
+			result.Status, result.Detail = CHECK_PASS, "set by "+resolution.Source
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// isRequiredPlaceholder tells whether the CLI can't work at all without the given placeholder
+func isRequiredPlaceholder(placeholderType int) bool {
+	switch placeholderType {
+	case settings.DOMAIN_SERVER_HOST_PLACEHOLDER, settings.TIBCO_ACCOUNTS_URL_PLACEHOLDER,
+		settings.TIBCO_ACCOUNTS_CLIENTID_PLACEHOLDER, settings.IDENTITY_MANAGEMENT_SERVER_HOST_PLACEHOLDER:
+		return true
+	}
+	return false
+}
+
+// checkSettingsDir checks the settings directory is writable and private to the user
+func checkSettingsDir() checkResult {
+	result := checkResult{Name: "Settings directory"}
+	dir, err := settings.GetSettingsDir()
+	if err != nil {
+		result.Status, result.Detail = CHECK_FAIL, err.Error()
+		return result
+	}
+
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		result.Status, result.Detail = CHECK_WARN, fmt.Sprintf("'%s' doesn't exist yet, it gets created on login", dir)
+		return result
+	} else if err != nil {
+		result.Status, result.Detail = CHECK_FAIL, err.Error()
+		return result
+	}
+
+	f, err := ioutil.TempFile(dir, ".doctor")
+	if err != nil {
+		result.Status, result.Detail = CHECK_FAIL, fmt.Sprintf("'%s' isn't writable: %s", dir, err.Error())
+		return result
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	if info.Mode().Perm()&0077 != 0 {
+		result.Status, result.Detail = CHECK_WARN, fmt.Sprintf("'%s' is accessible by other users (%s), it should be 0700", dir, info.Mode().Perm())
+		return result
+	}
+	result.Status, result.Detail = CHECK_PASS, dir
+	return result
+}
+
+// checkReachability resolves the host of the given URL and connects to it, doing the TLS handshake for https.
+// When a proxy is to be used, it checks a request goes through it instead. Nothing is checked in replay mode as the
+// network isn't used.
+func checkReachability(ctx context.Context, service, serverURL string) checkResult {
+	result := checkResult{Name: service + " reachability"}
+	if serverURL == "" {
+		result.Status, result.Detail = CHECK_FAIL, "URL is not set"
+		return result
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Host == "" {
+		result.Status, result.Detail = CHECK_FAIL, fmt.Sprintf("Invalid URL '%s'", serverURL)
+		return result
+	}
+	if utils.IsReplaying() {
+		result.Status, result.Detail = CHECK_WARN, fmt.Sprintf("not checked, replaying the responses recorded in '%s'", os.Getenv(consts.TASCLI_REPLAY))
+		return result
+	}
+
+	if proxyURL, err := http.ProxyFromEnvironment(&http.Request{URL: u}); err == nil && proxyURL != nil {
+		return checkReachabilityThroughProxy(ctx, result, u, proxyURL)
+	}
+
+	if _, err = net.DefaultResolver.LookupHost(ctx, u.Hostname()); err != nil {
+		result.Status, result.Detail = CHECK_FAIL, fmt.Sprintf("DNS lookup of '%s' failed: %s", u.Hostname(), err.Error())
+		return result
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	address := net.JoinHostPort(u.Hostname(), port)
+	dialer := &net.Dialer{Timeout: DOCTOR_DIAL_TIMEOUT}
+	if u.Scheme == "https" {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			tlsConfig := utils.GetTLSConfig()
+			tlsConfig.ServerName = u.Hostname()
+			tlsConn := tls.Client(conn, tlsConfig)
+			tlsConn.SetDeadline(time.Now().Add(DOCTOR_DIAL_TIMEOUT))
+			err = tlsConn.Handshake()
+			tlsConn.Close()
+		}
+		if err != nil {
+			result.Status, result.Detail = CHECK_FAIL, fmt.Sprintf("TLS connection to '%s' failed: %s", address, err.Error())
+			return result
+		}
+	} else {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			result.Status, result.Detail = CHECK_FAIL, fmt.Sprintf("Connection to '%s' failed: %s", address, err.Error())
+			return result
+		}
+		conn.Close()
+		result.Status, result.Detail = CHECK_WARN, fmt.Sprintf("'%s' is reachable but not over TLS", address)
+		return result
+	}
+	result.Status, result.Detail = CHECK_PASS, address
+	return result
+}
+
+// checkReachabilityThroughProxy sends a HEAD request to the given URL through the proxy, any response will do
+func checkReachabilityThroughProxy(ctx context.Context, result checkResult, u, proxyURL *url.URL) checkResult {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, u.String(), nil)
+	if err == nil {
+		var resp *http.Response
+		httpClient := utils.NewHTTPClient(nil)
+		httpClient.Timeout = DOCTOR_DIAL_TIMEOUT
+		if resp, err = httpClient.Do(request); err == nil {
+			resp.Body.Close()
+		}
+	}
+	if err != nil {
+		result.Status, result.Detail = CHECK_FAIL, fmt.Sprintf("Request to '%s' through proxy '%s' failed: %s", u.Host, proxyURL.Host, err.Error())
+		return result
+	}
+	result.Status, result.Detail = CHECK_PASS, fmt.Sprintf("%s through proxy %s", u.Host, proxyURL.Host)
+	return result
+}
+
+// checkPlatformApi checks the platform API version is compatible with this CLI
+func checkPlatformApi(ctx context.Context) checkResult {
+	result := checkResult{Name: "Platform API version"}
+	isValid, err := IsValidPlatformApi(ctx)
+	switch {
+	case err != nil:
+		result.Status, result.Detail = CHECK_FAIL, err.Error()
+	case !isValid:
+		result.Status, result.Detail = CHECK_FAIL, fmt.Sprintf("Platform API version isn't compatible with tibcli %s, please download a new tibcli", consts.CLI_VERSION)
+	default:
+		result.Status, result.Detail = CHECK_PASS, "compatible with tibcli "+consts.CLI_VERSION
+	}
+	return result
+}
+
+// checkClockSkew compares the local clock with the Date header of the Domain Server
+func checkClockSkew(ctx context.Context, domainURL string) checkResult {
+	result := checkResult{Name: "Clock skew"}
+	if domainURL == "" {
+		result.Status, result.Detail = CHECK_WARN, "Domain Server URL is not set, can't compare clocks"
+		return result
+	}
+	httpClient := utils.NewHTTPClient(nil)
+	httpClient.Timeout = DOCTOR_DIAL_TIMEOUT
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, domainURL, nil)
+	if err != nil {
+		result.Status, result.Detail = CHECK_WARN, fmt.Sprintf("Can't compare clocks: %s", err.Error())
+		return result
+	}
+	resp, err := httpClient.Do(request)
+	if err != nil {
+		result.Status, result.Detail = CHECK_WARN, fmt.Sprintf("Can't compare clocks: %s", err.Error())
+		return result
+	}
+	resp.Body.Close()
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		result.Status, result.Detail = CHECK_WARN, "Server didn't return its time, can't compare clocks"
+		return result
+	}
+
+	skew := time.Since(serverTime).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	switch {
+	case skew >= CLOCK_SKEW_FAIL_THRESHOLD:
+		result.Status = CHECK_FAIL
+	case skew >= CLOCK_SKEW_WARN_THRESHOLD:
+		result.Status = CHECK_WARN
+	default:
+		result.Status = CHECK_PASS
+	}
+	result.Detail = fmt.Sprintf("local clock differs from server's by %s", skew)
+	return result
+}
+
+// checkLoginState checks the TA access token and the IDM session, not being logged in is only a warning
+func checkLoginState(ctx context.Context) []checkResult {
+	tokenResult := checkResult{Name: "Access token"}
+	sessionResult := checkResult{Name: "Session"}
+
+	_, session, token, err := utils.LoadSettings()
+	if err != nil {
+		tokenResult.Status, tokenResult.Detail = CHECK_FAIL, err.Error()
+		sessionResult.Status, sessionResult.Detail = CHECK_FAIL, err.Error()
+		return []checkResult{tokenResult, sessionResult}
+	}
+
+	if token.AccessToken == nil {
+		tokenResult.Status, tokenResult.Detail = CHECK_WARN, "not logged in"
+	} else if CheckCookiesIsValid(ctx, []*http.Cookie{token.AccessToken}, settings.TOKEN_FILE_NAME) {
+		tokenResult.Status, tokenResult.Detail = CHECK_PASS, describeExpiry(token.AccessToken.Expires)
+	} else {
+		tokenResult.Status, tokenResult.Detail = CHECK_WARN, describeExpiry(token.AccessToken.Expires)
+	}
+
+	if len(session.Cookies) == 0 {
+		sessionResult.Status, sessionResult.Detail = CHECK_WARN, "not logged in"
+	} else if CheckCookiesIsValid(ctx, session.Cookies, settings.SESSION_FILENAME) {
+		sessionResult.Status, sessionResult.Detail = CHECK_PASS, "valid"
+	} else {
+		sessionResult.Status, sessionResult.Detail = CHECK_WARN, "expired"
+	}
+	return []checkResult{tokenResult, sessionResult}
+}
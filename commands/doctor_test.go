@@ -0,0 +1,322 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/utils"
+	"github.com/urfave/cli"
+)
+
+// doctorProxyTestEnv tells the test process is the one started to check the reachability through a proxy
+const doctorProxyTestEnv = "TASCLI_DOCTOR_PROXY_TEST"
+
+var doctorCommand = cli.Command{
+	Name:  "doctor",
+	Flags: []cli.Flag{cli.StringFlag{Name: "output, o", Value: "text"}},
+	Action: func(c *cli.Context) {
+		Doctor(c)
+	},
+}
+
+// checkStatus checks the given result has the expected status and a detail holding the expected text
+func checkStatus(t *testing.T, name string, result checkResult, status, detail string) {
+	if result.Status != status || !strings.Contains(result.Detail, detail) {
+		t.Errorf("%s: got [%s] '%s', expected [%s] with '%s'", name, result.Status, result.Detail, status, detail)
+	}
+}
+
+func TestCheckPlaceholders(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	env := server.env()
+	env["TASCLI_DOMAIN_URL"] = ""
+	env["TASCLI_REGION"] = ""
+	env["TASCLI_TENANT_ID"] = "tenant-1"
+	defer setEnv(env)()
+	settings.SetPlaceHolderFlag(settings.REGION_PLACEHOLDER, "eu-west")
+	defer settings.SetPlaceHolderFlag(settings.REGION_PLACEHOLDER, "")
+
+	results := map[string]checkResult{}
+	for _, result := range checkPlaceholders() {
+		results[result.Name] = result
+	}
+	if len(results) != len(settings.PLACEHOLDER_NAMES) {
+		t.Errorf("Got %d results, expected one per placeholder", len(results))
+	}
+
+	tests := []struct {
+		placeholderType int
+		status          string
+		detail          string
+	}{
+		{settings.TIBCO_ACCOUNTS_URL_PLACEHOLDER, CHECK_PASS, "set by environment TASCLI_TA_URL"},
+		{settings.TCI_TENANT_ID_PLACEHOLDER, CHECK_PASS, "set by environment TASCLI_TENANT_ID"},
+		{settings.REGION_PLACEHOLDER, CHECK_PASS, "set by flag"},
+		// the binary isn't patched, unset placeholders fail when required and are only warned about otherwise
+		{settings.DOMAIN_SERVER_HOST_PLACEHOLDER, CHECK_FAIL, "is not replaced"},
+		{settings.FTL_ENABLED_OPTION_PLACEHOLDER, CHECK_WARN, "is not replaced"},
+	}
+	for _, test := range tests {
+		name := "Placeholder " + settings.PLACEHOLDER_CONFIG_KEYS[test.placeholderType]
+		checkStatus(t, name, results[name], test.status, test.detail)
+	}
+}
+
+func TestCheckSettingsDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tas-cli-doctor-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer settings.SetSettingsDir(testSettingsDir)
+
+	tests := []struct {
+		name   string
+		dir    string
+		perm   os.FileMode
+		status string
+		detail string
+	}{
+		{name: "private", dir: path.Join(dir, "private"), perm: 0700, status: CHECK_PASS},
+		{name: "shared", dir: path.Join(dir, "shared"), perm: 0755, status: CHECK_WARN, detail: "it should be 0700"},
+		{name: "missing", dir: path.Join(dir, "missing"), status: CHECK_WARN, detail: "gets created on login"},
+		{name: "read-only", dir: path.Join(dir, "read-only"), perm: 0500, status: CHECK_FAIL, detail: "isn't writable"},
+	}
+	for _, test := range tests {
+		if test.perm == 0500 && os.Geteuid() == 0 {
+			// root writes whatever the permissions
+			continue
+		}
+		if test.perm != 0 {
+			if err = os.Mkdir(test.dir, test.perm); err != nil {
+				t.Fatal(err)
+			}
+			// not to depend on the umask
+			if err = os.Chmod(test.dir, test.perm); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = settings.SetSettingsDir(test.dir); err != nil {
+			t.Fatal(err)
+		}
+		result := checkSettingsDir()
+		checkStatus(t, test.name, result, test.status, test.detail)
+		if test.status == CHECK_PASS && result.Detail != test.dir {
+			t.Errorf("%s: detail '%s', expected the settings directory", test.name, result.Detail)
+		}
+	}
+}
+
+func TestCheckReachability(t *testing.T) {
+	resetSettings(t)
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+	secure := httptest.NewUnstartedServer(http.NotFoundHandler())
+	// the handshake rejected by the client is expected
+	secure.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	secure.StartTLS()
+	defer secure.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	caFile := path.Join(testSettingsDir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: secure.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer utils.ConfigureTransport(utils.TLSOptions{})
+
+	tests := []struct {
+		name    string
+		url     string
+		options utils.TLSOptions
+		status  string
+		detail  string
+	}{
+		{name: "unset", url: "", status: CHECK_FAIL, detail: "URL is not set"},
+		{name: "invalid", url: "not a url", status: CHECK_FAIL, detail: "Invalid URL"},
+		{name: "plain", url: plain.URL, status: CHECK_WARN, detail: "not over TLS"},
+		{name: "closed", url: closed.URL, status: CHECK_FAIL, detail: "Connection to"},
+		{name: "unknown CA", url: secure.URL, status: CHECK_FAIL, detail: "TLS connection to"},
+		{name: "trusted CA", url: secure.URL, options: utils.TLSOptions{CAFile: caFile}, status: CHECK_PASS,
+			detail: strings.TrimPrefix(secure.URL, "https://")},
+	}
+	for _, test := range tests {
+		if err := utils.ConfigureTransport(test.options); err != nil {
+			t.Fatal(err)
+		}
+		result := checkReachability(context.Background(), "Domain Server", test.url)
+		if result.Name != "Domain Server reachability" {
+			t.Errorf("%s: result named '%s'", test.name, result.Name)
+		}
+		checkStatus(t, test.name, result, test.status, test.detail)
+	}
+}
+
+func TestCheckReachabilitySkippedWhenReplaying(t *testing.T) {
+	resetSettings(t)
+	harFile := path.Join(testSettingsDir, "replay.har")
+	if err := ioutil.WriteFile(harFile, []byte(`{"log":{"version":"1.2","creator":{"name":"test","version":"1"},"entries":[]}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// the replay mode is turned off again once TASCLI_REPLAY is restored
+	defer utils.ConfigureCassettes()
+	defer setEnv(map[string]string{consts.TASCLI_REPLAY: harFile})()
+	if err := utils.ConfigureCassettes(); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing listens there, the network mustn't be used
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	checkStatus(t, "replaying", checkReachability(context.Background(), "Domain Server", closed.URL), CHECK_WARN, "not checked, replaying")
+}
+
+// the proxy environment variables are read once per process, the check runs in a process started with them
+func TestCheckReachabilityThroughProxy(t *testing.T) {
+	if os.Getenv(doctorProxyTestEnv) != "" {
+		result := checkReachability(context.Background(), "Domain Server", "http://domain.example.com")
+		checkStatus(t, "proxy", result, CHECK_PASS, "domain.example.com through proxy")
+		return
+	}
+
+	var lock sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		proxied = append(proxied, r.Method+" "+r.URL.String())
+		lock.Unlock()
+	}))
+	defer proxy.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCheckReachabilityThroughProxy$")
+	cmd.Env = append(os.Environ(), doctorProxyTestEnv+"=1", "HTTP_PROXY="+proxy.URL, "http_proxy="+proxy.URL, "NO_PROXY=", "no_proxy=")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Check through proxy failed: %v\n%s", err, output)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if expected := []string{"HEAD http://domain.example.com/"}; !reflect.DeepEqual(proxied, expected) {
+		t.Errorf("Proxy got %v, expected %v", proxied, expected)
+	}
+}
+
+func TestCheckPlatformApi(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	checkStatus(t, "compatible", checkPlatformApi(context.Background()), CHECK_PASS, "compatible with tibcli "+consts.CLI_VERSION)
+
+	server.handlers["/platformapiversion"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0.0.1"))
+	}
+	checkStatus(t, "incompatible", checkPlatformApi(context.Background()), CHECK_FAIL, "please download a new tibcli")
+
+	server.handlers["/platformapiversion"] = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	checkStatus(t, "unavailable", checkPlatformApi(context.Background()), CHECK_FAIL, "503")
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	var date []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a nil value keeps the server from adding the header
+		w.Header()["Date"] = date
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		date   []string
+		status string
+		detail string
+	}{
+		{name: "in sync", date: []string{time.Now().UTC().Format(http.TimeFormat)}, status: CHECK_PASS, detail: "differs from server's by"},
+		{name: "late", date: []string{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)}, status: CHECK_WARN, detail: "by 1m"},
+		{name: "ahead", date: []string{time.Now().Add(10 * time.Minute).UTC().Format(http.TimeFormat)}, status: CHECK_FAIL, detail: "differs from server's by"},
+		{name: "no date", date: nil, status: CHECK_WARN, detail: "didn't return its time"},
+	}
+	for _, test := range tests {
+		date = test.date
+		checkStatus(t, test.name, checkClockSkew(context.Background(), server.URL), test.status, test.detail)
+	}
+	checkStatus(t, "unset", checkClockSkew(context.Background(), ""), CHECK_WARN, "URL is not set")
+}
+
+func TestCheckLoginState(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	results := checkLoginState(context.Background())
+	checkStatus(t, "token before login", results[0], CHECK_WARN, "not logged in")
+	checkStatus(t, "session before login", results[1], CHECK_WARN, "not logged in")
+
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+	results = checkLoginState(context.Background())
+	checkStatus(t, "token", results[0], CHECK_PASS, "")
+	checkStatus(t, "session", results[1], CHECK_PASS, "valid")
+
+	// the Domain Server rejects the session
+	server.handlers[utils.GetDomainServerDefaultSandboxAPI()] = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	checkStatus(t, "expired session", checkLoginState(context.Background())[1], CHECK_WARN, "expired")
+}
+
+func TestDoctorJSONOutput(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	output := captureStdout(t, func() {
+		runCommand(t, []cli.Command{doctorCommand}, "doctor", "-o", "json")
+	})
+
+	var results []map[string]string
+	if err := json.Unmarshal([]byte(output), &results); err != nil {
+		t.Fatalf("Output isn't a JSON array of objects: %v\n%s", err, output)
+	}
+	var names []string
+	for _, result := range results {
+		if len(result) != 3 || result["name"] == "" || result["detail"] == "" {
+			t.Errorf("Result %v, expected a name, a status and a detail", result)
+		}
+		if status := result["status"]; status != CHECK_PASS && status != CHECK_WARN && status != CHECK_FAIL {
+			t.Errorf("Result %v has an unknown status", result)
+		}
+		if !strings.HasPrefix(result["name"], "Placeholder ") {
+			names = append(names, result["name"])
+		}
+	}
+	expected := []string{"Settings directory", "TIBCO Accounts reachability", "Identity-Management reachability",
+		"Domain Server reachability", "Platform API version", "Clock skew", "Access token", "Session"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Checks %v, expected %v", names, expected)
+	}
+	if len(results) != len(expected)+len(settings.PLACEHOLDER_NAMES) {
+		t.Errorf("Got %d results, expected %d", len(results), len(expected)+len(settings.PLACEHOLDER_NAMES))
+	}
+}
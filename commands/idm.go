@@ -0,0 +1,313 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Morphyni/tas-cli/client"
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/types"
+	"github.com/Morphyni/tas-cli/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// IdmLogin logs the user in to Identity-Management with the given TA access token and persists the resulting session.
+// When the user belongs to multiple organizations/regions, the one matching orgInfo is used. If several match, the
+// user gets prompted to pick one when loginFlag is set (i.e. user did input username/password), else it fails.
+func IdmLogin(ctx context.Context, idmServerURL, user, accessToken string, orgInfo types.OrgInfo, loginFlag bool) (err error) {
+
+	if loginFlag {
+		// start from a clean session, cookies of the previously used organization must not be sent along.
+		// The previous session is restored if the login fails, so that the user remains logged in.
+		var previous *settings.Session
+		if previous, err = utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE); err != nil {
+			log.Debugf("Previous session can't be read, it won't be restored if the login fails: %+v", err)
+			if previous, err = settings.NewSession(); err != nil {
+				return err
+			}
+			previous.Cookies = nil
+		}
+		if err = previous.Delete(); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil && len(previous.Cookies) > 0 {
+				log.Debug("Login failed, restoring the previous session")
+				if restoreErr := previous.Write(consts.OBFUSCATE_COOKIE_VALUE); restoreErr != nil {
+					log.Debugf("Restoring the previous session failed: %+v", restoreErr)
+				}
+			}
+		}()
+	} else if len(orgInfo.AccountName) == 0 && len(orgInfo.Region) == 0 {
+		// re-login, stick with the organization and region of the current session
+		cOrg, cRegion, err := utils.GetOrgAndRegion()
+		if err != nil {
+			log.Debugf("Retrieving current organization and region failed: %+v", err)
+		}
+		orgInfo = types.OrgInfo{AccountName: cOrg, Region: cRegion}
+	}
+
+	loginURL, err := url.Parse(idmServerURL)
+	if err != nil {
+		return err
+	}
+	loginURL.Path = utils.GetIdentityManagementLoginAPI()
+
+	responseBytes, err := idmLoginRequest(ctx, loginURL, accessToken, nil)
+	if err != nil {
+		return err
+	}
+
+	multiSubscriptionResp := &types.MultiSubscriptionLoginResponse{}
+	if err = json.Unmarshal(responseBytes, multiSubscriptionResp); err != nil {
+		return err
+	}
+
+	// the session is kept with the IDM server of the selected region, the profile only ever gets the global one
+	sessionIdmURL := idmServerURL
+	var selectedOrg *types.OrgDetails
+	if len(multiSubscriptionResp.Accounts) > 0 {
+		log.Debugf("User belongs to %d organizations", len(multiSubscriptionResp.Accounts))
+
+		selectedOrg, err = selectOrg(multiSubscriptionResp.Accounts, orgInfo, loginFlag)
+		if err != nil {
+			return err
+		}
+
+		regionURL, err := url.Parse(selectedOrg.RegionUrl)
+		if err != nil {
+			return err
+		}
+		regionURL.Path = utils.GetIdentityManagementLoginAPI()
+
+		body, err := json.Marshal(map[string]string{
+			"accountId":      selectedOrg.AccountId,
+			"subscriptionId": selectedOrg.SubscriptionId,
+		})
+		if err != nil {
+			return err
+		}
+		if responseBytes, err = idmLoginRequest(ctx, regionURL, accessToken, bytes.NewReader(body)); err != nil {
+			return err
+		}
+		sessionIdmURL = selectedOrg.RegionUrl
+	}
+
+	loginResp := &types.IDMLoginResponse{}
+	if err = json.Unmarshal(responseBytes, loginResp); err != nil {
+		return err
+	}
+
+	// without accounts to select from, IDM logs the user in to the organization of its choice
+	if selectedOrg == nil && len(orgInfo.AccountName) > 0 && !matchesLoggedInOrg(loginResp, orgInfo.AccountName) {
+		return errors.New(fmt.Sprintf("User can't log in to organization '%s', Identity-Management logged in to '%s' instead.",
+			orgInfo.AccountName, loginResp.OrgDisplayName))
+	}
+
+	if err = saveIdmLogin(ctx, idmServerURL, sessionIdmURL, user, loginResp, selectedOrg, multiSubscriptionResp.Accounts); err != nil {
+		return err
+	}
+
+	if loginFlag {
+		fmt.Printf("User '%s' logged in to organization '%s'.\n", user, loginResp.OrgDisplayName)
+	}
+	return nil
+}
+
+// idmLoginRequest posts the IDM login request with the TA access token to the given url and returns the response body
+func idmLoginRequest(ctx context.Context, loginURL *url.URL, accessToken string, body io.Reader) ([]byte, error) {
+
+	log.Debugf("Sending IDM login against url: '%s'", loginURL.String())
+
+	response, err := utils.RestCallAndCookiesRefreshHandler(
+		&types.RestCallRequest{
+			Context: ctx,
+			Service: "Identity-Management",
+			Url:     loginURL,
+			Headers: map[string]string{
+				"Content-Type":  "application/json",
+				"Authorization": "Bearer " + accessToken,
+			},
+			Method:       http.MethodPost,
+			Body:         body,
+			LogRequest:   false,
+			UserId:       "",
+			RetryAttempt: utils.GetRetryAttempt(),
+		})
+	if err != nil {
+		log.Debugf("Rest call and refresh cookies failed on error: '%+v'", err.Error())
+		return nil, err
+	}
+
+	if response.ErrorResponse != nil {
+		atmosError := response.ErrorResponse
+		log.Debugf("Error for POST '%s' url: ErrorCode: %s, ErrorMsg: %s, ErrorDetail: %s .",
+			loginURL.String(), atmosError.ErrorCode, atmosError.ErrorMsg, atmosError.ErrorDetail)
+		return nil, errors.New(atmosError.ErrorMsg)
+	}
+	return response.ResponseBytes, nil
+}
+
+// selectOrg picks the organization/region out of the accounts the user belongs to
+func selectOrg(accounts []types.AccountsInfo, orgInfo types.OrgInfo, interactive bool) (*types.OrgDetails, error) {
+	var candidates []types.OrgDetails
+	for _, account := range accounts {
+		org := types.OrgEntry{Name: account.AccountId, DisplayName: account.AccountDisplayName, SubscriptionId: account.SubscriptionId}
+		if len(orgInfo.AccountName) > 0 && !matchesOrg(org, orgInfo.AccountName) {
+			continue
+		}
+		for _, regionUrl := range account.RegionToUrls {
+			if len(orgInfo.Region) > 0 && !strings.EqualFold(regionUrl.Region, orgInfo.Region) {
+				continue
+			}
+			candidates = append(candidates, types.OrgDetails{
+				AccountName:    account.AccountDisplayName,
+				Region:         regionUrl.Region,
+				AccountId:      account.AccountId,
+				RegionUrl:      regionUrl.Url,
+				SubscriptionId: account.SubscriptionId,
+			})
+		}
+	}
+
+	switch {
+	case len(candidates) == 0:
+		if len(orgInfo.AccountName) > 0 || len(orgInfo.Region) > 0 {
+			return nil, errors.New(fmt.Sprintf("User doesn't belong to organization '%s' in region '%s'.", orgInfo.AccountName, orgInfo.Region))
+		}
+		return nil, errors.New("User doesn't belong to any organization.")
+	case len(candidates) == 1:
+		return &candidates[0], nil
+	case !interactive:
+		return nil, errors.New("User belongs to multiple organizations, please log in with organization name and region. ")
+	}
+
+	options := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		options[i] = fmt.Sprintf("%s (%s)", candidate.AccountName, candidate.Region)
+	}
+	return &candidates[utils.PromptForSelection("Select the organization to log in to:", options)], nil
+}
+
+// matchesLoggedInOrg tells whether the IDM login response is for the organization of the given name
+func matchesLoggedInOrg(loginResp *types.IDMLoginResponse, name string) bool {
+	org := types.OrgEntry{Name: loginResp.OrgName, DisplayName: loginResp.OrgDisplayName}
+	for _, entry := range loginResp.OrgList {
+		if entry.Name == loginResp.OrgName {
+			org.SubscriptionId = entry.SubscriptionId
+		}
+	}
+	return matchesOrg(org, name)
+}
+
+// saveIdmLogin persists the IDM login response along with the IDM server of the selected region into the session, and
+// the global IDM server along with the regions of the user's organizations into the profile
+func saveIdmLogin(ctx context.Context, idmServerURL, sessionIdmURL, user string, loginResp *types.IDMLoginResponse, selectedOrg *types.OrgDetails,
+	accounts []types.AccountsInfo) error {
+	// reload the session as it already got the cookies set by the login request
+	err := settings.WithLock(func() error {
+		session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+		if err != nil {
+			return err
+		}
+		session.FirstName = loginResp.FirstName
+		session.LastName = loginResp.LastName
+		session.UserName = loginResp.UserName
+		session.UserId = loginResp.UserId
+		session.OrgName = loginResp.OrgName
+		session.TS = loginResp.TS
+		session.DomainUrl = loginResp.DomainUrl
+		session.IdmUrl = sessionIdmURL
+		session.OrgDisplayName = loginResp.OrgDisplayName
+		session.OrgList = loginResp.OrgList
+		session.SubscriptionId = ""
+		if selectedOrg != nil {
+			session.SubscriptionId = selectedOrg.SubscriptionId
+		} else {
+			for _, org := range loginResp.OrgList {
+				if org.Name == loginResp.OrgName {
+					session.SubscriptionId = org.SubscriptionId
+				}
+			}
+		}
+		return session.Write(consts.OBFUSCATE_COOKIE_VALUE)
+	})
+	if err != nil {
+		return err
+	}
+
+	profile, err := utils.LoadProfile()
+	if err != nil {
+		return err
+	}
+	profile.Version = consts.CLI_VERSION
+	// only record the first IDM server & user, not to override the ones set with 'config set'
+	if len(profile.IDMConnectURL) == 0 {
+		profile.IDMConnectURL = idmServerURL
+	}
+	if len(profile.UserEmail) == 0 {
+		profile.UserEmail = user
+	}
+	if len(loginResp.KnownRegion) > 0 {
+		profile.KnownRegion = loginResp.KnownRegion
+	} else if selectedOrg != nil {
+		profile.KnownRegion = selectedOrg.Region
+	}
+	if len(accounts) > 0 {
+		profile.Regions = nil
+		seen := map[string]bool{}
+		for _, account := range accounts {
+			for _, regionUrl := range account.RegionToUrls {
+				if !seen[regionUrl.Region] {
+					seen[regionUrl.Region] = true
+					profile.Regions = append(profile.Regions, regionUrl)
+				}
+			}
+		}
+	}
+	if err = profile.Write(); err != nil {
+		return err
+	}
+
+	saveDefaultSandbox(ctx)
+	return nil
+}
+
+// saveDefaultSandbox keeps the default sandbox of the logged-in organization in the session, failures are non-fatal
+func saveDefaultSandbox(ctx context.Context) {
+	dsClient, err := client.NewDomainServer(ctx)
+	if err != nil {
+		log.Debugf("NON-FATAL: Initializing DomainServer client instance on error: %s", err.Error())
+		return
+	}
+	sandbox, _, err := dsClient.GetDefaultSandbox()
+	if err != nil {
+		log.Debugf("NON-FATAL: Retrieving default sandbox failed: %s", err.Error())
+		return
+	}
+	if err := persistDefaultSandbox(sandbox); err != nil {
+		log.Debugf("NON-FATAL: Persisting default sandbox failed: %s", err.Error())
+	}
+}
+
+// persistDefaultSandbox keeps the given default sandbox in the session
+func persistDefaultSandbox(sandbox *types.DomainServerSandboxBean) error {
+	// reload the session, the cookies got refreshed by the Domain Server call
+	return settings.WithLock(func() error {
+		session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+		if err != nil {
+			return err
+		}
+		session.DefaultSandboxName = sandbox.SandboxName
+		session.DefaultSandboxOrganizationId = sandbox.OrganizationId
+		return session.Write(consts.OBFUSCATE_COOKIE_VALUE)
+	})
+}
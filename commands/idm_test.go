@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/types"
+	"github.com/Morphyni/tas-cli/utils"
+)
+
+func TestIdmLoginToOtherOrgWithoutAccounts(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Cookies = []*http.Cookie{{Name: "idm-session", Value: "previous-session", Path: "/"}}
+	session.OrgName = "previous-org"
+	if err = session.Write(consts.OBFUSCATE_COOKIE_VALUE); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fake IDM only knows about 'acme' and doesn't send the accounts to select from
+	err = IdmLogin(context.Background(), server.URL, testUser, testAccessToken, types.OrgInfo{AccountName: "other"}, true)
+	if err == nil {
+		t.Fatal("Logging in to an organization IDM didn't log in to should fail")
+	}
+
+	session, err = utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Cookies) != 1 || session.Cookies[0].Value != "previous-session" || session.OrgName != "previous-org" {
+		t.Errorf("Previous session wasn't restored after the failed login: %+v", session)
+	}
+}
+
+func TestIdmLoginToSameOrgWithoutAccounts(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	err := IdmLogin(context.Background(), server.URL, testUser, testAccessToken, types.OrgInfo{AccountName: "ACME"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.OrgName != "acme" || len(session.Cookies) != 1 || session.Cookies[0].Value != testSessionCookie {
+		t.Errorf("Session %+v isn't the one of the new login", session)
+	}
+}
+
+// the organizations accepted by 'org switch' are the ones selectable on login
+func TestOrgMatching(t *testing.T) {
+	orgList := []types.OrgEntry{{Name: "acme", DisplayName: "Acme Corp", SubscriptionId: "sub-1"}}
+	accounts := []types.AccountsInfo{{
+		AccountId:          "acme",
+		AccountDisplayName: "Acme Corp",
+		SubscriptionId:     "sub-1",
+		RegionToUrls:       []types.RegionUrlInfo{{Region: "us-west", Url: "https://us.example.com"}},
+	}}
+
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{"acme", true},
+		{"ACME", true},
+		{"Acme Corp", true},
+		{"acme corp", true},
+		{"sub-1", true},
+		{"SUB-1", false},
+		{"other", false},
+	}
+	for _, test := range tests {
+		if belongs := belongsToOrg(orgList, test.name); belongs != test.expected {
+			t.Errorf("belongsToOrg('%s') = %t, expected %t", test.name, belongs, test.expected)
+		}
+		selected, err := selectOrg(accounts, types.OrgInfo{AccountName: test.name}, false)
+		if (err == nil) != test.expected {
+			t.Errorf("selectOrg('%s') = %+v, %v, expected a match: %t", test.name, selected, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/types"
+	"github.com/Morphyni/tas-cli/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// ListOrgs prints all organizations the logged-in user belongs to, marking the current one
+func ListOrgs(c *cli.Context) {
+	session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	utils.CheckError(err)
+
+	if len(session.OrgList) == 0 {
+		utils.CheckError(errors.New("No organizations found, please log in first."))
+	}
+
+	for _, org := range session.OrgList {
+		current := " "
+		if org.Name == session.OrgName {
+			current = "*"
+		}
+		fmt.Printf("%s %-30s %-40s %s\n", current, org.Name, org.DisplayName, org.SubscriptionId)
+	}
+}
+
+// SwitchOrg logs the user in to another organization reusing the still-valid TA access token, so no password is needed
+func SwitchOrg(c *cli.Context) {
+	if c.NArg() != 1 {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: "Please provide the name of the organization to switch to."})
+	}
+	orgInfo := types.OrgInfo{
+		AccountName: c.Args().First(),
+		Region:      c.String("region"),
+	}
+
+	profile, session, _, err := utils.LoadSettings()
+	utils.CheckError(err)
+	token, err := loadToken(c)
+	utils.CheckError(err)
+
+	if len(session.OrgList) > 0 && !belongsToOrg(session.OrgList, orgInfo.AccountName) {
+		utils.CheckError(errors.New(fmt.Sprintf("User doesn't belong to organization '%s'. Use 'org list' to display the available ones.", orgInfo.AccountName)))
+	}
+
+	// the token got renewed if needed by the RenewToken before action, it may not have been persisted
+	ctx := utils.CommandContext(c)
+	if !CheckCookiesIsValid(ctx, []*http.Cookie{token.AccessToken}, settings.TOKEN_FILE_NAME) {
+		utils.CheckError(errors.New("TIBCO Accounts access token is missing or expired, please log in again."))
+	}
+
+	idmServerURL, err := resolveIdmServerURL()
+	utils.CheckError(err)
+
+	userEmail := profile.UserEmail
+	if len(userEmail) == 0 {
+		userEmail, err = utils.GetUserEmail()
+		utils.CheckError(err)
+	}
+
+	log.Debugf("Switching to organization '%s', region '%s'", orgInfo.AccountName, orgInfo.Region)
+	utils.CheckError(IdmLogin(ctx, idmServerURL, userEmail, token.AccessToken.Value, orgInfo, true))
+}
+
+// belongsToOrg checks the given organization name is one of the user's organizations
+func belongsToOrg(orgList []types.OrgEntry, name string) bool {
+	for _, org := range orgList {
+		if matchesOrg(org, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesOrg tells whether the organization asked for by the user is the given one, by name, display name or
+// subscription id. It's the one matcher for the organizations coming from the session and from IDM login responses.
+func matchesOrg(org types.OrgEntry, name string) bool {
+	return strings.EqualFold(org.Name, name) || strings.EqualFold(org.DisplayName, name) ||
+		(len(org.SubscriptionId) > 0 && org.SubscriptionId == name)
+}
+
+// resolveIdmServerURL returns the IDM server url given with the --idm-url flag or the TASCLI_IDM_URL environment
+// variable, else the one of the profile, recorded on first login or set with 'config set', falling back to the config
+// file and the placeholder
+func resolveIdmServerURL() (string, error) {
+	resolution := settings.ResolvePlaceHolder(settings.IDENTITY_MANAGEMENT_SERVER_HOST_PLACEHOLDER)
+	if resolution.Source == settings.FLAG_SOURCE || strings.HasPrefix(resolution.Source, settings.ENV_SOURCE) {
+		return resolution.Value, nil
+	}
+	profile, err := utils.LoadProfile()
+	if err == nil && len(profile.IDMConnectURL) > 0 {
+		return profile.IDMConnectURL, nil
+	}
+	if resolution.Err != nil || len(resolution.Value) == 0 {
+		if resolution.Err != nil {
+			log.Debug(resolution.Err.Error())
+		}
+		return "", errors.New("Identity-Management Server URL is not set.")
+	}
+	return resolution.Value, nil
+}
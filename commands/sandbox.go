@@ -0,0 +1,289 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Morphyni/tas-cli/client"
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/types"
+	"github.com/Morphyni/tas-cli/utils"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// sandboxDetails is a sandbox along with the apps it references, it's what sandbox show & default print out
+type sandboxDetails struct {
+	types.DomainServerSandboxBean
+	Default      bool                                `json:"default"`
+	Applications []types.DomainServerApplicationBean `json:"applications"`
+	// ids of the referenced apps the Domain Server couldn't find
+	MissingApplicationIds []string `json:"missingApplicationIds,omitempty"`
+}
+
+// ListSandboxes prints the sandboxes of the user, or of the whole organization with --all, filtered by type & visibility
+func ListSandboxes(c *cli.Context) {
+	output := checkOutputFormat(c)
+	visibility := checkVisibility(c)
+	dsClient := newDomainServerClient(c)
+
+	var sandboxesResponse *types.DomainServerGetSandboxesResponse
+	var err error
+	if c.Bool("all") {
+		sandboxesResponse, err = dsClient.GetOrgSandboxes()
+	} else {
+		sandboxesResponse, err = dsClient.GetSandboxes("", "")
+	}
+	checkDomainServerError(err)
+	printOperationWarning(sandboxesResponse.OperationWarning)
+
+	sandboxType := c.String("type")
+	sandboxes := []types.DomainServerSandboxBean{}
+	for _, sandbox := range sandboxesResponse.Sandboxes {
+		if len(sandboxType) > 0 && !strings.EqualFold(sandbox.SandboxType, sandboxType) {
+			continue
+		}
+		if len(visibility) > 0 && !strings.EqualFold(sandbox.Visibility, visibility) {
+			continue
+		}
+		sandboxes = append(sandboxes, sandbox)
+	}
+
+	if output == "json" {
+		printJSON(sandboxes)
+		return
+	}
+
+	if len(sandboxes) == 0 {
+		fmt.Println("No sandboxes found.")
+		return
+	}
+	defaultSandboxName := loadDefaultSandboxName()
+	fmt.Printf("  %-30s %-30s %-12s %-12s %s\n", "NAME", "DISPLAY NAME", "TYPE", "VISIBILITY", "APPS")
+	for _, sandbox := range sandboxes {
+		current := " "
+		if sandbox.SandboxName == defaultSandboxName {
+			current = "*"
+		}
+		fmt.Printf("%s %-30s %-30s %-12s %-12s %d\n", current, sandbox.SandboxName, sandbox.DisplayName,
+			sandbox.SandboxType, sandbox.Visibility, len(sandbox.ApplicationIds))
+	}
+}
+
+// ShowSandbox prints the given sandbox, looked up by name or id, along with its apps
+func ShowSandbox(c *cli.Context) {
+	if c.NArg() != 1 {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: "Please provide the name or the id of the sandbox to show."})
+	}
+	output := checkOutputFormat(c)
+	dsClient := newDomainServerClient(c)
+
+	sandbox, err := findSandbox(dsClient, c.Args().First())
+	utils.CheckError(err)
+	printSandbox(dsClient, sandbox, sandbox.SandboxName == loadDefaultSandboxName(), output)
+}
+
+// ShowDefaultSandbox prints the default sandbox of the organization along with its apps, and refreshes the one kept in the session
+func ShowDefaultSandbox(c *cli.Context) {
+	output := checkOutputFormat(c)
+	dsClient := newDomainServerClient(c)
+
+	sandbox, _, err := dsClient.GetDefaultSandbox()
+	checkDomainServerError(err)
+	if err := persistDefaultSandbox(sandbox); err != nil {
+		log.Debugf("NON-FATAL: Persisting default sandbox failed: %s", err.Error())
+	}
+	printSandbox(dsClient, sandbox, true, output)
+}
+
+// UpdateSandbox changes the display name, description or visibility of the given sandbox
+func UpdateSandbox(c *cli.Context) {
+	if c.NArg() != 1 {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: "Please provide the name or the id of the sandbox to update."})
+	}
+	if !c.IsSet("display-name") && !c.IsSet("description") && !c.IsSet("visibility") {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: "Please provide at least one of --display-name, --description or --visibility."})
+	}
+	visibility := checkVisibility(c)
+	dsClient := newDomainServerClient(c)
+
+	sandbox, err := findSandbox(dsClient, c.Args().First())
+	utils.CheckError(err)
+
+	if c.IsSet("display-name") {
+		sandbox.DisplayName = c.String("display-name")
+	}
+	if c.IsSet("description") {
+		sandbox.Description = c.String("description")
+	}
+	if c.IsSet("visibility") {
+		sandbox.Visibility = visibility
+	}
+	body, err := json.Marshal(sandbox)
+	utils.CheckError(err)
+
+	log.Debugf("Updating sandbox '%s' (%s)", sandbox.SandboxName, sandbox.Id)
+	successResponse, err := dsClient.UpdateSandbox(sandbox.Id, body)
+	checkDomainServerError(err)
+	if len(successResponse.Message) > 0 {
+		fmt.Println(successResponse.Message)
+	} else {
+		fmt.Printf("Sandbox '%s' updated.\n", sandbox.SandboxName)
+	}
+}
+
+// checkVisibility returns the --visibility of the command as known by the Domain Server, exiting if it's unknown
+func checkVisibility(c *cli.Context) string {
+	if !c.IsSet("visibility") {
+		return ""
+	}
+	visibility := c.String("visibility")
+	for _, known := range consts.SANDBOX_VISIBILITIES {
+		if strings.EqualFold(visibility, known) {
+			return known
+		}
+	}
+	utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: fmt.Sprintf("Unknown visibility '%s', use one of: %s.",
+		visibility, strings.Join(consts.SANDBOX_VISIBILITIES, ", "))})
+	return ""
+}
+
+// newDomainServerClient creates the Domain Server client of the command, its requests get aborted on interrupt
+func newDomainServerClient(c *cli.Context) client.DomainServer {
+	dsClient, err := client.NewDomainServer(utils.CommandContext(c))
+	utils.CheckError(err)
+	return dsClient
+}
+
+// checkDomainServerError is CheckError telling the user to log in again when the session is no longer valid
+func checkDomainServerError(err error) {
+	if client.IsSessionExpired(err) {
+		log.Debug(err.Error())
+		err = errors.New("Session expired, please log in again.")
+	}
+	utils.CheckError(err)
+}
+
+// checkOutputFormat returns the --output format of the command, exiting if it's unknown
+func checkOutputFormat(c *cli.Context) string {
+	output := c.String("output")
+	if output != "text" && output != "json" {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: fmt.Sprintf("Unknown output format '%s', use 'text' or 'json'.", output)})
+	}
+	return output
+}
+
+// printJSON prints the given value as indented JSON
+func printJSON(v interface{}) {
+	bytes, err := json.MarshalIndent(v, "", "  ")
+	utils.CheckError(err)
+	fmt.Println(string(bytes))
+}
+
+// printOperationWarning prints the warning the Domain Server may send along with a response, on stderr so the JSON output remains valid
+func printOperationWarning(warning string) {
+	if len(warning) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+}
+
+// loadDefaultSandboxName returns the name of the default sandbox kept in the session, consts.DEFAULT_SANDBOX if unknown
+func loadDefaultSandboxName() string {
+	session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		log.Debugf("NON-FATAL: Loading session failed: %s", err.Error())
+	} else if len(session.DefaultSandboxName) > 0 {
+		return session.DefaultSandboxName
+	}
+	return consts.DEFAULT_SANDBOX
+}
+
+// findSandbox looks the sandbox up by its name or display name, falling back to its id
+func findSandbox(dsClient client.DomainServer, nameOrId string) (*types.DomainServerSandboxBean, error) {
+	sandboxesResponse, err := dsClient.GetSandboxes(nameOrId, "")
+	if !client.IsNotFound(err) {
+		checkDomainServerError(err)
+		printOperationWarning(sandboxesResponse.OperationWarning)
+		for _, sandbox := range sandboxesResponse.Sandboxes {
+			if strings.EqualFold(sandbox.SandboxName, nameOrId) || strings.EqualFold(sandbox.DisplayName, nameOrId) || sandbox.Id == nameOrId {
+				sandbox := sandbox
+				return &sandbox, nil
+			}
+		}
+	}
+
+	sandbox, err := dsClient.GetSandbox(nameOrId)
+	if client.IsNotFound(err) {
+		return nil, errors.New(fmt.Sprintf("Sandbox '%s' not found. Use 'sandbox list' to display the available ones.", nameOrId))
+	}
+	checkDomainServerError(err)
+	return sandbox, nil
+}
+
+// printSandbox prints the given sandbox along with the apps referenced by its ApplicationIds, all retrieved at once
+func printSandbox(dsClient client.DomainServer, sandbox *types.DomainServerSandboxBean, isDefault bool, output string) {
+	details := sandboxDetails{
+		DomainServerSandboxBean: *sandbox,
+		Default:                 isDefault,
+		Applications:            []types.DomainServerApplicationBean{},
+	}
+	apps := map[string]types.DomainServerApplicationBean{}
+	if len(sandbox.ApplicationIds) > 0 {
+		appsResponse, err, notFound := dsClient.GetApplicationsInSandbox(sandbox.Id)
+		if notFound {
+			log.Debugf("Applications of sandbox '%s' not found: %s", sandbox.SandboxName, err.Error())
+		} else {
+			checkDomainServerError(err)
+			for _, app := range appsResponse.ApplicationBeans {
+				apps[app.Id] = app
+			}
+		}
+	}
+	for _, appId := range sandbox.ApplicationIds {
+		if app, ok := apps[appId]; ok {
+			details.Applications = append(details.Applications, app)
+		} else {
+			details.MissingApplicationIds = append(details.MissingApplicationIds, appId)
+		}
+	}
+
+	if output == "json" {
+		printJSON(details)
+		return
+	}
+
+	fmt.Printf("Name:           %s\n", details.SandboxName)
+	fmt.Printf("Display name:   %s\n", details.DisplayName)
+	fmt.Printf("Id:             %s\n", details.Id)
+	fmt.Printf("Description:    %s\n", details.Description)
+	fmt.Printf("Type:           %s\n", details.SandboxType)
+	fmt.Printf("Visibility:     %s\n", details.Visibility)
+	fmt.Printf("Endpoint type:  %s\n", details.EndpointType)
+	fmt.Printf("Default:        %t\n", details.Default)
+	fmt.Printf("Created:        %s by %s\n", formatMillis(details.CreatedTime), details.CreatedBy)
+	fmt.Printf("Last updated:   %s by %s\n", formatMillis(details.LastUpdatedTime), details.LastModifiedBy)
+	fmt.Printf("Used by:        %s\n", strings.Join(details.UsedBy, ", "))
+	if len(details.ApplicationIds) == 0 {
+		fmt.Println("Applications:   none")
+		return
+	}
+	fmt.Println("Applications:")
+	for _, app := range details.Applications {
+		fmt.Printf("  %-30s %-12s %s\n", app.ApplicationName, app.Version, app.Id)
+	}
+	for _, appId := range details.MissingApplicationIds {
+		fmt.Printf("  %-30s %-12s %s\n", "(not found)", "", appId)
+	}
+}
+
+// formatMillis renders the given Domain Server timestamp, in milliseconds since epoch
+func formatMillis(millis int64) string {
+	if millis == 0 {
+		return "unknown"
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)).Local().Format(time.RFC1123)
+}
@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Morphyni/tas-cli/types"
+	"github.com/Morphyni/tas-cli/utils"
+	"github.com/urfave/cli"
+)
+
+// sandboxVisibilityTestEnv tells the test process is the one started to list the sandboxes of an unknown visibility
+const sandboxVisibilityTestEnv = "TASCLI_SANDBOX_VISIBILITY_TEST"
+
+var sandboxCommand = cli.Command{
+	Name: "sandbox",
+	Subcommands: []cli.Command{
+		{
+			Name: "list",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "output, o", Value: "text"},
+				cli.BoolFlag{Name: "all, a"},
+				cli.StringFlag{Name: "type, t"},
+				cli.StringFlag{Name: "visibility, v"},
+			},
+			Before: CheckPlatformVersionAndLogin,
+			Action: func(c *cli.Context) {
+				ListSandboxes(c)
+			},
+		},
+		{
+			Name:   "default",
+			Flags:  []cli.Flag{cli.StringFlag{Name: "output, o", Value: "text"}},
+			Before: CheckPlatformVersionAndLogin,
+			Action: func(c *cli.Context) {
+				ShowDefaultSandbox(c)
+			},
+		},
+		{
+			Name: "update",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "display-name"},
+				cli.StringFlag{Name: "description"},
+				cli.StringFlag{Name: "visibility"},
+			},
+			Before: CheckPlatformVersionAndLogin,
+			Action: func(c *cli.Context) {
+				UpdateSandbox(c)
+			},
+		},
+	},
+}
+
+// captureStdout returns what the given function prints
+func captureStdout(t *testing.T, f func()) string {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan []byte)
+	go func() {
+		bytes, _ := ioutil.ReadAll(reader)
+		output <- bytes
+	}()
+	f()
+	writer.Close()
+	return string(<-output)
+}
+
+func TestShowDefaultSandbox(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	server.handlers[utils.GetDomainServerDefaultSandboxAPI()] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.DomainServerSandboxBean{Id: "sbx-1", SandboxName: "MyDefaultSandbox", ApplicationIds: []string{"app-2", "app-1", "app-gone"}})
+	}
+	server.handlers[utils.GetDomainServerListAppsAPI("sbx-1")] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.DomainServerApplicationsResponse{ApplicationBeans: []types.DomainServerApplicationBean{
+			{Id: "app-1", ApplicationName: "first"},
+			{Id: "app-2", ApplicationName: "second"},
+		}})
+	}
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+	server.lock.Lock()
+	server.requests = nil
+	server.lock.Unlock()
+
+	output := captureStdout(t, func() {
+		runCommand(t, []cli.Command{sandboxCommand}, "sandbox", "default", "-o", "json")
+	})
+
+	// the session is checked first, then the apps are fetched at once, not one by one
+	expected := []string{
+		"GET /platformapiversion",
+		"GET " + utils.GetDomainServerDefaultSandboxAPI(),
+		"GET " + utils.GetDomainServerDefaultSandboxAPI(),
+		"GET " + utils.GetDomainServerListAppsAPI("sbx-1"),
+	}
+	if !reflect.DeepEqual(server.paths(), expected) {
+		t.Fatalf("Requests %v, expected %v", server.paths(), expected)
+	}
+
+	var details sandboxDetails
+	if err := json.Unmarshal([]byte(output), &details); err != nil {
+		t.Fatalf("Output isn't JSON: %v\n%s", err, output)
+	}
+	var names []string
+	for _, app := range details.Applications {
+		names = append(names, app.ApplicationName)
+	}
+	if !details.Default || !reflect.DeepEqual(names, []string{"second", "first"}) {
+		t.Errorf("Displayed default %t and apps %v, expected the default sandbox's apps in order", details.Default, names)
+	}
+	if !reflect.DeepEqual(details.MissingApplicationIds, []string{"app-gone"}) {
+		t.Errorf("Missing apps %v, expected app-gone", details.MissingApplicationIds)
+	}
+}
+
+func TestUpdateSandboxVisibility(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	server.handlers[utils.GetDomainServerGetSandboxesAPI()] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.DomainServerGetSandboxesResponse{Sandboxes: []types.DomainServerSandboxBean{
+			{Id: "sbx-1", SandboxName: "MySandbox", Visibility: "private"},
+		}})
+	}
+	server.handlers[utils.GetDomainServerGetSandboxAPI("sbx-1")] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.SuccessResponse{})
+	}
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+
+	captureStdout(t, func() {
+		runCommand(t, []cli.Command{sandboxCommand}, "sandbox", "update", "--visibility", "Public", "MySandbox")
+	})
+
+	request := server.request(t, utils.GetDomainServerGetSandboxAPI("sbx-1"))
+	var sandbox types.DomainServerSandboxBean
+	if err := json.Unmarshal([]byte(request.Body), &sandbox); err != nil {
+		t.Fatal(err)
+	}
+	if request.Method != http.MethodPut || sandbox.Visibility != "public" {
+		t.Errorf("%s with visibility '%s', expected a PUT with 'public'", request.Method, sandbox.Visibility)
+	}
+}
+
+func TestListSandboxes(t *testing.T) {
+	resetSettings(t)
+	server := newFakeServer(t)
+	defer server.Close()
+	defer setEnv(server.env())()
+
+	server.handlers[utils.GetDomainServerGetSandboxesAPI()] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.DomainServerGetSandboxesResponse{Sandboxes: []types.DomainServerSandboxBean{
+			{Id: "sbx-1", SandboxName: "MySandbox", Visibility: "private"},
+		}})
+	}
+	server.handlers[utils.GetDomainServerGetOpSandboxesAPI()] = func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(t, w, types.DomainServerGetSandboxesResponse{Sandboxes: []types.DomainServerSandboxBean{
+			{Id: "sbx-1", SandboxName: "MySandbox", Visibility: "private"},
+			{Id: "sbx-2", SandboxName: "TheirSandbox", Visibility: "public"},
+		}})
+	}
+	runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+
+	tests := []struct {
+		args  []string
+		path  string
+		names []string
+	}{
+		{args: nil, path: utils.GetDomainServerGetSandboxesAPI(), names: []string{"MySandbox"}},
+		{args: []string{"--all"}, path: utils.GetDomainServerGetOpSandboxesAPI(), names: []string{"MySandbox", "TheirSandbox"}},
+		{args: []string{"--all", "--visibility", "Public"}, path: utils.GetDomainServerGetOpSandboxesAPI(), names: []string{"TheirSandbox"}},
+	}
+	if utils.GetDomainServerGetSandboxesAPI() == utils.GetDomainServerGetOpSandboxesAPI() {
+		t.Fatalf("The user's and the organization's sandboxes are both at '%s'", utils.GetDomainServerGetSandboxesAPI())
+	}
+
+	for _, test := range tests {
+		server.lock.Lock()
+		server.requests = nil
+		server.lock.Unlock()
+
+		output := captureStdout(t, func() {
+			runCommand(t, []cli.Command{sandboxCommand}, append([]string{"sandbox", "list", "-o", "json"}, test.args...)...)
+		})
+
+		paths := server.paths()
+		if len(paths) == 0 || paths[len(paths)-1] != "GET "+test.path {
+			t.Errorf("%v: requests %v, expected the last one on %s", test.args, paths, test.path)
+		}
+		var sandboxes []types.DomainServerSandboxBean
+		if err := json.Unmarshal([]byte(output), &sandboxes); err != nil {
+			t.Fatalf("%v: output isn't JSON: %v\n%s", test.args, err, output)
+		}
+		var names []string
+		for _, sandbox := range sandboxes {
+			names = append(names, sandbox.SandboxName)
+		}
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%v: listed %v, expected %v", test.args, names, test.names)
+		}
+	}
+}
+
+// the command exits on an unknown visibility, it's run by a process started for that
+func TestListSandboxesUnknownVisibility(t *testing.T) {
+	if os.Getenv(sandboxVisibilityTestEnv) != "" {
+		resetSettings(t)
+		server := newFakeServer(t)
+		defer server.Close()
+		defer setEnv(server.env())()
+		runCommand(t, []cli.Command{loginCommand}, "login", "-u", testUser, "-p", testPassword)
+
+		app := cli.NewApp()
+		app.Commands = []cli.Command{sandboxCommand}
+		app.Run([]string{"tibcli", "sandbox", "list", "--visibility", "privat"})
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestListSandboxesUnknownVisibility$")
+	cmd.Env = append(os.Environ(), sandboxVisibilityTestEnv+"=1")
+	output, err := cmd.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); !ok || !strings.Contains(string(output), "Unknown visibility 'privat', use one of: private, public.") {
+		t.Errorf("Listing got %v, expected to exit on the unknown visibility:\n%s", err, output)
+	}
+}
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/utils"
+	"github.com/urfave/cli"
+)
+
+// identity summarises the current user's session, it's what whoami prints out
+type identity struct {
+	FirstName          string    `json:"firstName"`
+	LastName           string    `json:"lastName"`
+	UserName           string    `json:"userName"`
+	UserId             string    `json:"userId"`
+	OrgName            string    `json:"orgName"`
+	OrgDisplayName     string    `json:"orgDisplayName"`
+	Region             string    `json:"region"`
+	SubscriptionId     string    `json:"subscriptionId"`
+	DomainUrl          string    `json:"domainUrl"`
+	DefaultSandboxName string    `json:"defaultSandboxName"`
+	TokenExpires       time.Time `json:"tokenExpires"`
+	TokenValid         bool      `json:"tokenValid"`
+	SessionValid       bool      `json:"sessionValid"`
+}
+
+// Whoami prints the identity of the logged-in user, as plain text or as JSON with --output json
+func Whoami(c *cli.Context) {
+	output := c.String("output")
+	if output != "text" && output != "json" {
+		utils.CheckError(&utils.IncorrectUsageError{Context: c, Msg: fmt.Sprintf("Unknown output format '%s', use 'text' or 'json'.", output)})
+	}
+
+	session, err := utils.LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	utils.CheckError(err)
+	token, err := loadToken(c)
+	utils.CheckError(err)
+
+	if len(session.UserName) == 0 && len(session.Cookies) == 0 {
+		utils.CheckError(errors.New("User is not logged in."))
+	}
+
+	_, region, err := utils.GetOrgAndRegion()
+	utils.CheckError(err)
+	domainUrl, err := utils.GetDomainURL()
+	utils.CheckError(err)
+
+	ctx := utils.CommandContext(c)
+
+	id := identity{
+		FirstName:          session.FirstName,
+		LastName:           session.LastName,
+		UserName:           session.UserName,
+		UserId:             session.UserId,
+		OrgName:            session.OrgName,
+		OrgDisplayName:     session.OrgDisplayName,
+		Region:             region,
+		SubscriptionId:     session.SubscriptionId,
+		DomainUrl:          domainUrl,
+		DefaultSandboxName: session.DefaultSandboxName,
+		SessionValid:       CheckCookiesIsValid(ctx, session.Cookies, settings.SESSION_FILENAME),
+	}
+	if token.AccessToken != nil {
+		id.TokenExpires = token.AccessToken.Expires
+		id.TokenValid = CheckCookiesIsValid(ctx, []*http.Cookie{token.AccessToken}, settings.TOKEN_FILE_NAME)
+	}
+
+	utils.CheckError(ctx.Err())
+
+	if output == "json" {
+		bytes, err := json.MarshalIndent(id, "", "  ")
+		utils.CheckError(err)
+		fmt.Println(string(bytes))
+		return
+	}
+
+	fmt.Printf("User:             %s %s (%s)\n", id.FirstName, id.LastName, id.UserName)
+	fmt.Printf("User Id:          %s\n", id.UserId)
+	fmt.Printf("Organization:     %s (%s)\n", id.OrgDisplayName, id.OrgName)
+	fmt.Printf("Region:           %s\n", id.Region)
+	fmt.Printf("Subscription Id:  %s\n", id.SubscriptionId)
+	fmt.Printf("Domain URL:       %s\n", id.DomainUrl)
+	fmt.Printf("Default sandbox:  %s\n", id.DefaultSandboxName)
+	fmt.Printf("Access token:     %s\n", describeExpiry(id.TokenExpires))
+	if id.SessionValid {
+		fmt.Println("Session:          valid")
+	} else {
+		fmt.Println("Session:          expired")
+	}
+}
+
+// describeExpiry renders the given expiry time as a countdown
+func describeExpiry(expires time.Time) string {
+	if expires.IsZero() {
+		return "none"
+	}
+	remaining := time.Until(expires).Round(time.Second)
+	if remaining <= 0 {
+		return fmt.Sprintf("expired %s ago", -remaining)
+	}
+	return fmt.Sprintf("expires in %s (%s)", remaining, expires.Local().Format(time.RFC1123))
+}
@@ -10,6 +10,8 @@ const (
 	TASCLI_DBG string = "TASCLI_DBG"
 
 	OBFUSCATE_COOKIE_VALUE = true
+	//environment property holding the passphrase the key encrypting cookies & tokens at rest is derived from
+	TASCLI_PASSPHRASE string = "TASCLI_PASSPHRASE"
 	// Context paths of all WebClient's
 	WEB_SERVER_CONTEXT_PATH          string = "/api/"
 	DOMAIN_SERVER_CONTEXT_PATH       string = "/domain/"
@@ -44,9 +46,11 @@ const (
 	DOMAIN_SERVER_LOGIN_API string = "/login-oauth"
 
 	// IdentityManagementServer WebClient API's
-	IDENTITY_MANAGEMENT_LOGIN_API string = "/login-oauth"
+	IDENTITY_MANAGEMENT_LOGIN_API  string = "/login-oauth"
+	IDENTITY_MANAGEMENT_LOGOUT_API string = "/logout"
 
-	DOMAIN_SERVER_SANDBOXES_API string = "/sandboxes"
+	DOMAIN_SERVER_SANDBOXES_API     string = "/sandboxes"
+	DOMAIN_SERVER_ORG_SANDBOXES_API string = "/organization/sandboxes"
 
 	DOMAIN_SERVER_USERS_API string = "/users"
 
@@ -65,6 +69,16 @@ const (
 	COMPLETED_STATUS string = "completed"
 	//environment property governing persistence of OAuth tokens
 	DONT_PERSIST string = "TIBCLI_DONT_PERSIST"
+	//environment property overriding the settings directory (~/.tibcli by default)
+	TASCLI_HOME string = "TASCLI_HOME"
+	//environment property selecting the named context (i.e. profile, session and token) to use
+	TASCLI_CONTEXT string = "TASCLI_CONTEXT"
+	//environment property selecting where session & token are kept: file, keyring, env, memory or none
+	TASCLI_CREDENTIAL_STORE string = "TASCLI_CREDENTIAL_STORE"
+	//environment property serving the responses from the given HAR file, or the ones of the given directory, instead of the network
+	TASCLI_REPLAY string = "TASCLI_REPLAY"
+	//environment property recording the traffic to the HAR file of the given directory, for TASCLI_REPLAY
+	TASCLI_RECORD string = "TASCLI_RECORD"
 
 	//Hostname and port settings for the current local envrioment.
 	WEBAPI_LOCAL_HOST = "http://localhost"
@@ -75,4 +89,11 @@ const (
 
 const (
 	DEFAULT_SANDBOX = "MyDefaultSandbox"
+
+	// visibilities a sandbox can be given with 'sandbox update'
+	SANDBOX_VISIBILITY_PRIVATE = "private"
+	SANDBOX_VISIBILITY_PUBLIC  = "public"
 )
+
+// SANDBOX_VISIBILITIES are all the visibilities a sandbox can be given
+var SANDBOX_VISIBILITIES = []string{SANDBOX_VISIBILITY_PRIVATE, SANDBOX_VISIBILITY_PUBLIC}
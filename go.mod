@@ -3,7 +3,10 @@ module github.com/Morphyni/tas-cli
 go 1.13
 
 require (
+	github.com/godbus/dbus/v5 v5.0.6
 	github.com/sirupsen/logrus v1.4.2
 	github.com/urfave/cli v1.22.2
+	github.com/zalando/go-keyring v0.2.1
 	golang.org/x/crypto v0.0.0-20200210222208-86ce3cb69678
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -1,22 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
 
+	"github.com/Morphyni/tas-cli/commands"
 	"github.com/Morphyni/tas-cli/consts"
 	"github.com/Morphyni/tas-cli/eula"
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/utils"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+// outputFlag selects the output format of the commands supporting machine-readable output
+var outputFlag = cli.StringFlag{
+	Name:  "output, o",
+	Usage: "Output format: 'text' or 'json'.",
+	Value: "text",
+}
+
 func main() {
-	listenSignals()
+	utils.InstallRedactionHook()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	listenSignals(cancel)
+
+	// settings writes in progress must complete before exiting on interrupt
+	utils.RegisterShutdownHandler("wait for settings writes", settings.WaitForWrites)
 
 	app := cli.NewApp()
+	utils.SetCommandContext(app, ctx)
 	app.Name = consts.CLI_MODULE_NAME
 	app.Usage = consts.CLI_MODULE_USAGE
 	app.Version = consts.CLI_VERSION
@@ -26,12 +43,79 @@ func main() {
 		fmt.Fprintf(ctx.App.Writer, "Command '%v' does not exist. Type tibcli -h to list valid commands.\n", command)
 	}
 
-	app.Before = setLogLevel
+	app.Before = before
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
 			Name:  "debug, d",
 			Usage: "Enable debug logging.",
 		},
+		cli.StringFlag{
+			Name:  "config-dir",
+			Usage: "Keep the settings in the given directory. Overrides TASCLI_HOME.",
+		},
+		cli.StringFlag{
+			Name:  "context",
+			Usage: "Use the profile, session and token of the given context. Overrides TASCLI_CONTEXT and 'context use'.",
+		},
+		cli.StringFlag{
+			Name:  "domain-url",
+			Usage: "Domain Server URL. Overrides TASCLI_DOMAIN_URL and the config file.",
+		},
+		cli.StringFlag{
+			Name:  "idm-url",
+			Usage: "Identity-Management Server URL. Overrides TASCLI_IDM_URL and the config file.",
+		},
+		cli.StringFlag{
+			Name:  "ta-url",
+			Usage: "TIBCO Accounts URL. Overrides TASCLI_TA_URL and the config file.",
+		},
+		cli.StringFlag{
+			Name:  "client-id",
+			Usage: "TIBCO Accounts client id. Overrides TASCLI_CLIENT_ID and the config file.",
+		},
+		cli.StringFlag{
+			Name:  "region",
+			Usage: "Region of the servers. Overrides TASCLI_REGION and the config file.",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "Overall deadline of the command, e.g. 5m. Overrides the 'timeout' config key. No deadline by default.",
+		},
+		cli.DurationFlag{
+			Name:  "request-timeout",
+			Usage: "Timeout of every request to the servers, e.g. 30s, 0 for none. Overrides the 'requestTimeout' config key.",
+			Value: utils.DEFAULT_REQUEST_TIMEOUT,
+		},
+		cli.StringFlag{
+			Name:  "ca-file",
+			Usage: "Trust the CA certificates of the given PEM file on top of the system ones, e.g. a corporate CA.",
+		},
+		cli.StringFlag{
+			Name:  "client-cert",
+			Usage: "PEM client certificate presented to the servers asking for one. Requires --client-key.",
+		},
+		cli.StringFlag{
+			Name:  "client-key",
+			Usage: "PEM private key of the client certificate.",
+		},
+		cli.BoolFlag{
+			Name:  "insecure-skip-tls-verify",
+			Usage: "Don't verify the certificates of the servers. Insecure, for test deployments only.",
+		},
+		cli.StringFlag{
+			Name:  "record-http",
+			Usage: "Record all requests to the servers and their responses to the given HAR file, secrets redacted.",
+		},
+		cli.IntFlag{
+			Name:  "retries",
+			Usage: "Number of times a request is retried when the server can't be reached or is unavailable.",
+			Value: utils.DEFAULT_RETRIES,
+		},
+		cli.DurationFlag{
+			Name:  "retry-max-wait",
+			Usage: "Longest wait before retrying a request, e.g. 30s. A server asking to wait longer isn't retried.",
+			Value: utils.DEFAULT_RETRY_MAX_WAIT,
+		},
 	}
 
 	app.Commands = []cli.Command{
@@ -50,12 +134,10 @@ func main() {
 				cli.StringFlag{
 					Name:  "username, u",
 					Usage: "The username. If username is specified, the password option has to be specified as well.",
-					Value: "<username>",
 				},
 				cli.StringFlag{
 					Name:  "password, p",
 					Usage: "the user's password",
-					Value: "<password>",
 				},
 				cli.StringFlag{
 					Name:  "org, o",
@@ -67,11 +149,233 @@ func main() {
 				},
 			},
 			Action: func(c *cli.Context) {
-				nflags := c.NumFlags()
-				arg1 := c.String("password")
-				arg2 := c.String("o")
-				fmt.Println("Args: ", arg1, arg2)
-				fmt.Println("Nflags: ", nflags)
+				commands.Login(c)
+			},
+		},
+		{
+			Name:  "logout",
+			Usage: "Log out the user from server and remove the local session",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all, a",
+					Usage: "Remove the local profile as well.",
+				},
+			},
+			Action: func(c *cli.Context) {
+				commands.Logout(c)
+			},
+		},
+		{
+			Name:      "whoami",
+			Usage:     "Display the logged-in user, organization, region and session status",
+			ArgsUsage: " ",
+			Flags:     []cli.Flag{outputFlag},
+			Before:    commands.RenewToken,
+			Action: func(c *cli.Context) {
+				commands.Whoami(c)
+			},
+		},
+		{
+			Name:   "session",
+			Usage:  "Inspect the current session",
+			Before: commands.RenewToken,
+			Subcommands: []cli.Command{
+				{
+					Name:      "show",
+					Usage:     "Display the logged-in user, organization, region and session status",
+					ArgsUsage: " ",
+					Flags:     []cli.Flag{outputFlag},
+					Action: func(c *cli.Context) {
+						commands.Whoami(c)
+					},
+				},
+			},
+		},
+		{
+			Name:   "org",
+			Usage:  "List the user's organizations or switch to another one",
+			Before: commands.RenewToken,
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					Usage:     "Display all organizations the user belongs to",
+					ArgsUsage: " ",
+					Action: func(c *cli.Context) {
+						commands.ListOrgs(c)
+					},
+				},
+				{
+					Name:      "switch",
+					Usage:     "Switch to another organization without entering the password again",
+					ArgsUsage: "<org name>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "region, r",
+							Usage: "the region of the organization",
+						},
+					},
+					Action: func(c *cli.Context) {
+						commands.SwitchOrg(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "sandbox",
+			Usage: "List, inspect and update the sandboxes of the organization",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					Usage:     "Display the user's sandboxes, marking the default one",
+					ArgsUsage: " ",
+					Flags: []cli.Flag{
+						outputFlag,
+						cli.BoolFlag{
+							Name:  "all, a",
+							Usage: "display all sandboxes of the organization",
+						},
+						cli.StringFlag{
+							Name:  "type, t",
+							Usage: "only display the sandboxes of the given type",
+						},
+						cli.StringFlag{
+							Name:  "visibility, v",
+							Usage: "only display the sandboxes of the given visibility",
+						},
+					},
+					Before: commands.CheckPlatformVersionAndLogin,
+					Action: func(c *cli.Context) {
+						commands.ListSandboxes(c)
+					},
+				},
+				{
+					Name:      "show",
+					Usage:     "Display a sandbox along with its applications",
+					ArgsUsage: "<sandbox name or id>",
+					Flags:     []cli.Flag{outputFlag},
+					Before:    commands.CheckPlatformVersionAndLogin,
+					Action: func(c *cli.Context) {
+						commands.ShowSandbox(c)
+					},
+				},
+				{
+					Name:      "default",
+					Usage:     "Display the default sandbox of the organization along with its applications",
+					ArgsUsage: " ",
+					Flags:     []cli.Flag{outputFlag},
+					Before:    commands.CheckPlatformVersionAndLogin,
+					Action: func(c *cli.Context) {
+						commands.ShowDefaultSandbox(c)
+					},
+				},
+				{
+					Name:      "update",
+					Usage:     "Change the display name, description or visibility of a sandbox",
+					ArgsUsage: "<sandbox name or id>",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "display-name",
+							Usage: "the new display name",
+						},
+						cli.StringFlag{
+							Name:  "description",
+							Usage: "the new description",
+						},
+						cli.StringFlag{
+							Name:  "visibility",
+							Usage: "the new visibility: private or public",
+						},
+					},
+					Before: commands.CheckPlatformVersionAndLogin,
+					Action: func(c *cli.Context) {
+						commands.UpdateSandbox(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "context",
+			Usage: "Manage the named contexts, each one having its own login",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					Usage:     "Display all contexts",
+					ArgsUsage: " ",
+					Action: func(c *cli.Context) {
+						commands.ListContexts(c)
+					},
+				},
+				{
+					Name:      "use",
+					Usage:     "Use the given context from now on, creating it if needed",
+					ArgsUsage: "<context name>",
+					Action: func(c *cli.Context) {
+						commands.UseContext(c)
+					},
+				},
+				{
+					Name:      "delete",
+					Usage:     "Delete the given context along with its login",
+					ArgsUsage: "<context name>",
+					Action: func(c *cli.Context) {
+						commands.DeleteContext(c)
+					},
+				},
+			},
+		},
+		{
+			Name:  "config",
+			Usage: "Inspect the configuration and edit the user-level settings",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					Usage:     "Display all user-level settings",
+					ArgsUsage: " ",
+					Action: func(c *cli.Context) {
+						commands.ListConfig(c)
+					},
+				},
+				{
+					Name:      "get",
+					Usage:     "Display the value of a user-level setting",
+					ArgsUsage: "<key>",
+					Action: func(c *cli.Context) {
+						commands.GetConfig(c)
+					},
+				},
+				{
+					Name:      "set",
+					Usage:     "Change the value of a user-level setting",
+					ArgsUsage: "<key> <value>",
+					Action: func(c *cli.Context) {
+						commands.SetConfig(c)
+					},
+				},
+				{
+					Name:      "unset",
+					Usage:     "Clear a user-level setting",
+					ArgsUsage: "<key>",
+					Action: func(c *cli.Context) {
+						commands.UnsetConfig(c)
+					},
+				},
+				{
+					Name:      "show",
+					Usage:     "Display the server URLs & co. in use and where each one comes from",
+					ArgsUsage: " ",
+					Action: func(c *cli.Context) {
+						commands.ShowConfig(c)
+					},
+				},
+			},
+		},
+		{
+			Name:      "doctor",
+			Usage:     "Diagnose the configuration and the connectivity to the servers",
+			ArgsUsage: " ",
+			Flags:     []cli.Flag{outputFlag},
+			Action: func(c *cli.Context) {
+				commands.Doctor(c)
 			},
 		},
 		{
@@ -103,41 +407,138 @@ func main() {
 	// 	fmt.Println("boom displayed: Hello!")
 	// 	fmt.Println()
 	// }
-	app.Run(os.Args)
+	err := app.Run(os.Args)
+	cancelTimeout()
+
+	// the command may have completed despite being interrupted
+	if ctx.Err() != nil {
+		utils.ExitInterrupted()
+	}
+	// e.g. invalid global flags rejected by before
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 }
 
-// listenSignals listening the os interrupt signal like ctrl+c and do os.Exit
-func listenSignals() {
+// listenSignals listening the os interrupt signal like ctrl+c, cancels the command context so that pending requests
+// get aborted, runs the shutdown handlers and exits with code 130
+func listenSignals(cancel context.CancelFunc) {
 	log.Debug("Listening system signals ...")
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	signal.Notify(c, syscall.SIGTERM)
-	go func() {
-		// check whether the output device is a terminal or not
-		if terminal.IsTerminal(int(os.Stdout.Fd())) {
-			// Remember the state before any invocation on terminal like terminal.ReadPassword()
-			log.Debug("You're a terminal.")
-			state, err := terminal.GetState(int(os.Stdin.Fd()))
-			if err != nil {
-				log.Debug("terminal.GetState() failed, exit.")
-				os.Exit(1)
-			}
-
-			if c != nil {
-				<-c
-				fmt.Println()
-				// Restore the state before any invocation on terminal like terminal.ReadPassword(),
-				// without this step the terminal runs the tibcli will make all the following input after exit() get invisible
-				terminal.Restore(int(os.Stdin.Fd()), state)
-				log.Debug("System interrupt signal received, exit.")
-				//TODO utils.ExecAllShutdownHandlers()
-				os.Exit(1)
-			}
-		} else {
-			log.Debug("You're not a terminal.")
+
+	// check whether the output device is a terminal or not
+	var state *terminal.State
+	if terminal.IsTerminal(int(os.Stdout.Fd())) {
+		// Remember the state before any invocation on terminal like terminal.ReadPassword()
+		log.Debug("You're a terminal.")
+		var err error
+		if state, err = terminal.GetState(int(os.Stdin.Fd())); err != nil {
+			log.Debug("terminal.GetState() failed, the terminal won't be restored on interrupt.")
+		}
+	} else {
+		log.Debug("You're not a terminal.")
+	}
+
+	utils.HandleSignals(cancel, func() {
+		if state != nil {
+			fmt.Println()
+			// Restore the state before any invocation on terminal like terminal.ReadPassword(),
+			// without this step the terminal runs the tibcli will make all the following input after exit() get invisible
+			terminal.Restore(int(os.Stdin.Fd()), state)
+		}
+	})
+}
+
+// before runs ahead of any command, applying the global flags
+func before(c *cli.Context) error {
+	if err := setLogLevel(c); err != nil {
+		return err
+	}
+	if err := setSettingsDir(c); err != nil {
+		return err
+	}
+	setPlaceHolderFlags(c)
+	if err := setRetryPolicy(c); err != nil {
+		return err
+	}
+	if err := setTransport(c); err != nil {
+		return err
+	}
+	if err := utils.ConfigureCassettes(); err != nil {
+		return err
+	}
+	if c.IsSet("record-http") {
+		if err := utils.StartHarRecording(c.String("record-http")); err != nil {
+			return err
+		}
+	}
+	if err := setContext(c); err != nil {
+		return err
+	}
+	return setTimeouts(c)
+}
+
+// placeholderFlags maps the global flags to the placeholders they override
+var placeholderFlags = map[string]int{
+	"domain-url": settings.DOMAIN_SERVER_HOST_PLACEHOLDER,
+	"idm-url":    settings.IDENTITY_MANAGEMENT_SERVER_HOST_PLACEHOLDER,
+	"ta-url":     settings.TIBCO_ACCOUNTS_URL_PLACEHOLDER,
+	"client-id":  settings.TIBCO_ACCOUNTS_CLIENTID_PLACEHOLDER,
+	"region":     settings.REGION_PLACEHOLDER,
+}
+
+func setPlaceHolderFlags(c *cli.Context) {
+	for flag, placeholderType := range placeholderFlags {
+		if c.IsSet(flag) {
+			settings.SetPlaceHolderFlag(placeholderType, c.String(flag))
 		}
+	}
+}
+
+// cancelTimeout releases the resources of the command deadline, if any
+var cancelTimeout context.CancelFunc = func() {}
+
+// setTimeouts applies the --timeout and --request-timeout flags, falling back to the config keys of the profile
+func setTimeouts(c *cli.Context) error {
+	cancel, err := utils.ConfigureTimeouts(c)
+	if err != nil {
+		return err
+	}
+	cancelTimeout = cancel
+	return nil
+}
+
+// setTransport configures the transport shared by all clients with the TLS flags, the proxy coming from HTTPS_PROXY
+// and NO_PROXY
+func setTransport(c *cli.Context) error {
+	return utils.ConfigureTransport(utils.TLSOptions{
+		CAFile:             c.String("ca-file"),
+		ClientCert:         c.String("client-cert"),
+		ClientKey:          c.String("client-key"),
+		InsecureSkipVerify: c.Bool("insecure-skip-tls-verify"),
+	})
+}
 
-	}()
+func setRetryPolicy(c *cli.Context) error {
+	if c.Int("retries") < 0 {
+		return errors.New("--retries can't be negative.")
+	}
+	utils.SetRetryPolicy(c.Int("retries"), c.Duration("retry-max-wait"))
+	return nil
+}
+
+func setSettingsDir(c *cli.Context) error {
+	if c.IsSet("config-dir") {
+		return settings.SetSettingsDir(c.String("config-dir"))
+	}
+	return nil
+}
+
+func setContext(c *cli.Context) error {
+	if c.IsSet("context") {
+		return settings.SetContext(c.String("context"))
+	}
+	return nil
 }
 
 func setLogLevel(c *cli.Context) error {
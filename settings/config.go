@@ -0,0 +1,118 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	CONFIG_FILENAME string = "config.yaml"
+)
+
+// Sources a placeholder value can come from, from the lowest to the highest precedence
+const (
+	PLACEHOLDER_SOURCE string = "placeholder"
+	CONFIG_FILE_SOURCE string = "config file"
+	ENV_SOURCE         string = "environment"
+	FLAG_SOURCE        string = "flag"
+)
+
+// PLACEHOLDER_CONFIG_KEYS are the keys overriding the placeholders in the config file, indexed by placeholder type
+var PLACEHOLDER_CONFIG_KEYS = [...]string{
+	"username",
+	"domainUrl",
+	"taUrl",
+	"clientId",
+	"idmUrl",
+	"tenantId",
+	"region",
+	"deploymentName",
+	"ftlEnabled",
+}
+
+// PLACEHOLDER_ENV_NAMES are the environment variables overriding the placeholders, indexed by placeholder type
+var PLACEHOLDER_ENV_NAMES = [...]string{
+	"TASCLI_USERNAME",
+	"TASCLI_DOMAIN_URL",
+	"TASCLI_TA_URL",
+	"TASCLI_CLIENT_ID",
+	"TASCLI_IDM_URL",
+	"TASCLI_TENANT_ID",
+	"TASCLI_REGION",
+	"TASCLI_DEPLOYMENT_NAME",
+	"TASCLI_FTL_ENABLED",
+}
+
+// PlaceHolderResolution tells the value of a placeholder and the source it comes from
+type PlaceHolderResolution struct {
+	Name   string
+	Value  string
+	Source string
+	Err    error // set if the value isn't usable, i.e. the placeholder isn't replaced and nothing overrides it
+}
+
+// placeholderFlags holds the values given on the command line, see SetPlaceHolderFlag
+var placeholderFlags = map[int]string{}
+
+// configFile caches the content of the config file once loaded
+var configFile map[string]string
+
+// SetPlaceHolderFlag overrides the value of the given placeholder with a command line flag value
+func SetPlaceHolderFlag(placeholderType int, value string) {
+	placeholderFlags[placeholderType] = value
+}
+
+// ResolvePlaceHolder returns the value of the given placeholder, looking in order of precedence at the command
+// line flags, the TASCLI_* environment variables, the config file and finally the value patched into the binary
+func ResolvePlaceHolder(placeholderType int) PlaceHolderResolution {
+	name := PLACEHOLDER_NAMES[placeholderType]
+
+	if value := strings.TrimSpace(placeholderFlags[placeholderType]); value != "" {
+		return PlaceHolderResolution{Name: name, Value: value, Source: FLAG_SOURCE}
+	}
+	if value := strings.TrimSpace(os.Getenv(PLACEHOLDER_ENV_NAMES[placeholderType])); value != "" {
+		return PlaceHolderResolution{Name: name, Value: value, Source: ENV_SOURCE + " " + PLACEHOLDER_ENV_NAMES[placeholderType]}
+	}
+	config, err := readConfigFile()
+	if err != nil {
+		log.Debugf("Reading config file failed, ignoring it: %s", err.Error())
+	} else if value := strings.TrimSpace(config[PLACEHOLDER_CONFIG_KEYS[placeholderType]]); value != "" {
+		return PlaceHolderResolution{Name: name, Value: value, Source: CONFIG_FILE_SOURCE}
+	}
+
+	err, value := getPatchedPlaceHolderValue(placeholderType)
+	return PlaceHolderResolution{Name: name, Value: value, Source: PLACEHOLDER_SOURCE, Err: err}
+}
+
+// readConfigFile loads the flat 'key: value' config file from the settings directory, it's empty if there's no file
+func readConfigFile() (map[string]string, error) {
+	if configFile != nil {
+		return configFile, nil
+	}
+
+	sf, err := newSharedSettingsFile(CONFIG_FILENAME)
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]string{}
+	if sf.fileExists(sf.filePath) {
+		bytes, err := ioutil.ReadFile(sf.filePath)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.Unmarshal(bytes, &config); err != nil {
+			return nil, errors.New(fmt.Sprintf("Config file '%s' is invalid: %s", sf.filePath, err.Error()))
+		}
+	}
+	configFile = config
+	return configFile, nil
+}
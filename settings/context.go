@@ -0,0 +1,185 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Morphyni/tas-cli/consts"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DEFAULT_CONTEXT is the context whose settings files are directly in the settings directory, as they
+	// always were before contexts got introduced
+	DEFAULT_CONTEXT string = "default"
+	// CONTEXTS_DIR is the directory in the settings directory holding one sub-directory per other context
+	CONTEXTS_DIR string = "contexts"
+	// CURRENT_CONTEXT_FILENAME is the file keeping the name of the context selected by 'context use'
+	CURRENT_CONTEXT_FILENAME string = "context"
+)
+
+var contextNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// selectedContext is the context explicitly chosen for this process, see SetContext
+var selectedContext string
+
+// SetContext selects the context used by this process, overriding the environment and the one selected by 'context use'
+func SetContext(name string) error {
+	if err := ValidateContextName(name); err != nil {
+		return err
+	}
+	selectedContext = name
+	return nil
+}
+
+// GetContext returns the context in use, looking in order at SetContext, the environment variable and the context
+// selected by 'context use', falling back to the default one
+func GetContext() string {
+	if selectedContext != "" {
+		return selectedContext
+	}
+	if name := os.Getenv(consts.TASCLI_CONTEXT); name != "" {
+		if err := ValidateContextName(name); err == nil {
+			return name
+		}
+		log.Debugf("Ignoring invalid context name '%s' set in environment variable '%s'", name, consts.TASCLI_CONTEXT)
+	}
+	if name, err := readCurrentContext(); err == nil && name != "" {
+		return name
+	}
+	return DEFAULT_CONTEXT
+}
+
+// ValidateContextName checks the given context name can be used as a directory name
+func ValidateContextName(name string) error {
+	if !contextNameRegexp.MatchString(name) {
+		return errors.New(fmt.Sprintf("Invalid context name '%s', only letters, digits, '_', '-' and '.' are allowed.", name))
+	}
+	return nil
+}
+
+// ListContexts returns the names of all contexts, the default one included
+func ListContexts() ([]string, error) {
+	sf, err := newSharedSettingsFile(CONTEXTS_DIR)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{DEFAULT_CONTEXT}
+	entries, err := ioutil.ReadDir(sf.filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && ValidateContextName(entry.Name()) == nil && entry.Name() != DEFAULT_CONTEXT {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names[1:])
+	return names, nil
+}
+
+// UseContext makes the given context the one used by default from now on, creating it if needed
+func UseContext(name string) error {
+	if err := ValidateContextName(name); err != nil {
+		return err
+	}
+	if name != DEFAULT_CONTEXT {
+		sf, err := newSharedSettingsFile(contextFilePath(name, ""))
+		if err != nil {
+			return err
+		}
+		perm := os.FileMode(0700) // drwx------
+		if err = os.MkdirAll(sf.filePath, perm); err != nil {
+			return err
+		}
+	}
+
+	sf, err := newSharedSettingsFile(CURRENT_CONTEXT_FILENAME)
+	if err != nil {
+		return err
+	}
+	if name == DEFAULT_CONTEXT {
+		return sf.deleteFile()
+	}
+	if err = sf.createSettingsDir(); err != nil {
+		return err
+	}
+	perm := os.FileMode(0600) // -rw-------
+	return writeFileAtomic(sf.filePath, []byte(name), perm)
+}
+
+// DeleteContext deletes the profile, session and token of the given context along with its directory,
+// and falls back to the default context if it was the one in use
+func DeleteContext(name string) error {
+	if name == DEFAULT_CONTEXT {
+		return errors.New("The default context can't be deleted.")
+	}
+	if err := ValidateContextName(name); err != nil {
+		return err
+	}
+
+	// session and token may be kept outside of the context directory, depending on the context's credential store
+	store, err := getCredentialStore(name)
+	if err != nil {
+		return err
+	}
+	for _, filename := range []string{SESSION_FILENAME, TOKEN_FILE_NAME} {
+		sf, err := newSharedSettingsFile(contextFilePath(name, filename))
+		if err != nil {
+			return err
+		}
+		sf.store = store
+		if err = sf.deleteFile(); err != nil {
+			return err
+		}
+	}
+
+	sf, err := newSharedSettingsFile(contextFilePath(name, ""))
+	if err != nil {
+		return err
+	}
+	if err = os.RemoveAll(sf.filePath); err != nil {
+		return err
+	}
+	if current, err := readCurrentContext(); err == nil && current == name {
+		return UseContext(DEFAULT_CONTEXT)
+	}
+	return nil
+}
+
+// readCurrentContext returns the context selected by 'context use', empty if there's none
+func readCurrentContext() (string, error) {
+	sf, err := newSharedSettingsFile(CURRENT_CONTEXT_FILENAME)
+	if err != nil {
+		return "", err
+	}
+	if !sf.fileExists(sf.filePath) {
+		return "", nil
+	}
+	bytes, err := ioutil.ReadFile(sf.filePath)
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(string(bytes))
+	if err = ValidateContextName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// contextFilePath returns the path of the given settings file of the given context, relative to the settings directory
+func contextFilePath(name, filename string) string {
+	if name == DEFAULT_CONTEXT {
+		return filename
+	}
+	return path.Join(CONTEXTS_DIR, name, filename)
+}
@@ -0,0 +1,348 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Morphyni/tas-cli/consts"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando/go-keyring"
+)
+
+// Credential store backends
+const (
+	FILE_CREDENTIAL_STORE    string = "file"    // files in the settings directory, the default
+	MEMORY_CREDENTIAL_STORE  string = "memory"  // kept in memory for the life of the process only
+	ENV_CREDENTIAL_STORE     string = "env"     // read from environment variables, writes are kept in memory
+	KEYRING_CREDENTIAL_STORE string = "keyring" // OS keyring, i.e. Secret Service on Linux, Keychain on macOS, Credential Manager on Windows
+	NONE_CREDENTIAL_STORE    string = "none"    // alias of memory: nothing is ever persisted
+)
+
+// CredentialStore keeps the serialized settings holding secrets, i.e. the session and the token
+type CredentialStore interface {
+	// Load returns the content stored under the given name, nil if there's none
+	Load(name string) ([]byte, error)
+
+	// Save stores the given content under the given name, replacing any previous one
+	Save(name string, data []byte) error
+
+	// Delete removes the content stored under the given name, it's a no-op if there's none
+	Delete(name string) error
+}
+
+// make sure that all backends implement the CredentialStore interface
+var _ CredentialStore = (*fileStore)(nil)
+var _ CredentialStore = (*memoryStore)(nil)
+var _ CredentialStore = (*envStore)(nil)
+var _ CredentialStore = (*keyringStore)(nil)
+
+var (
+	// credentialStores caches the credential store of each context
+	credentialStores    map[string]CredentialStore
+	credentialStoreLock sync.Mutex
+)
+
+// getCredentialStore returns the credential store of the given context, selected by the environment variable or else
+// by the profile of the context, defaulting to files in the settings directory. The store of each context is created
+// once and shared for the life of the process.
+func getCredentialStore(context string) (CredentialStore, error) {
+	credentialStoreLock.Lock()
+	defer credentialStoreLock.Unlock()
+
+	if store, ok := credentialStores[context]; ok {
+		return store, nil
+	}
+
+	backend := os.Getenv(consts.TASCLI_CREDENTIAL_STORE)
+	if backend == "" {
+		profile, err := newContextProfile(context)
+		if err != nil {
+			return nil, err
+		}
+		if err = profile.Read(); err != nil {
+			return nil, err
+		}
+		backend = profile.CredentialStore
+	}
+
+	store, err := newCredentialStore(backend)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Using '%s' credential store for context '%s'", backend, context)
+	if credentialStores == nil {
+		credentialStores = map[string]CredentialStore{}
+	}
+	credentialStores[context] = store
+	return store, nil
+}
+
+// moveCredentials moves the session and token of the context of the given profile from the credential store of the
+// previous backend to the one now set in the profile. Backends which don't persist anything can't take them over,
+// they're cleared from the previous store anyway and the user has to log in again.
+func moveCredentials(p *Profile, previous string) error {
+	if backend := os.Getenv(consts.TASCLI_CREDENTIAL_STORE); backend != "" {
+		log.Warnf("The '%s' credential store set with %s is used as long as it's set.", backend, consts.TASCLI_CREDENTIAL_STORE)
+		return nil
+	}
+	// nothing is left behind by backends which don't persist anything
+	if !isPersistentBackend(previous) || backendName(previous) == backendName(p.CredentialStore) {
+		return nil
+	}
+	from, err := newCredentialStore(previous)
+	if err != nil {
+		return err
+	}
+	to, err := newCredentialStore(p.CredentialStore)
+	if err != nil {
+		return err
+	}
+
+	moved, cleared := false, false
+	dir := path.Dir(p.name())
+	for _, filename := range []string{SESSION_FILENAME, TOKEN_FILE_NAME} {
+		name := path.Join(dir, filename)
+		data, err := from.Load(name)
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			continue
+		}
+		if isPersistentBackend(p.CredentialStore) {
+			if err = to.Save(name, data); err != nil {
+				return err
+			}
+			moved = true
+		} else {
+			cleared = true
+		}
+		if err = from.Delete(name); err != nil {
+			return err
+		}
+	}
+	if moved {
+		log.Debugf("Session and token moved to the '%s' credential store", p.CredentialStore)
+	}
+	if cleared {
+		log.Warnf("Session and token can't be kept in the '%s' credential store, please log in again.", p.CredentialStore)
+	}
+
+	credentialStoreLock.Lock()
+	credentialStores = nil
+	credentialStoreLock.Unlock()
+	return nil
+}
+
+// backendName returns the canonical name of the given credential store backend
+func backendName(backend string) string {
+	if backend == "" {
+		return FILE_CREDENTIAL_STORE
+	}
+	return strings.ToLower(backend)
+}
+
+// isPersistentBackend tells whether the credential store backend of the given name keeps the contents across processes
+func isPersistentBackend(backend string) bool {
+	switch backendName(backend) {
+	case FILE_CREDENTIAL_STORE, KEYRING_CREDENTIAL_STORE:
+		return true
+	}
+	return false
+}
+
+// newCredentialStore creates the credential store backend of the given name
+func newCredentialStore(backend string) (CredentialStore, error) {
+	switch strings.ToLower(backend) {
+	case "", FILE_CREDENTIAL_STORE:
+		sf := &settingsFile{}
+		dir, err := sf.getSettingsDir()
+		if err != nil {
+			return nil, err
+		}
+		return &fileStore{dir: dir}, nil
+	case MEMORY_CREDENTIAL_STORE, NONE_CREDENTIAL_STORE:
+		return newMemoryStore(), nil
+	case ENV_CREDENTIAL_STORE:
+		return &envStore{memoryStore: newMemoryStore()}, nil
+	case KEYRING_CREDENTIAL_STORE:
+		return &keyringStore{keyring: defaultKeyring}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown credential store '%s', valid ones are: %s, %s, %s, %s, %s.", backend,
+		FILE_CREDENTIAL_STORE, KEYRING_CREDENTIAL_STORE, ENV_CREDENTIAL_STORE, MEMORY_CREDENTIAL_STORE, NONE_CREDENTIAL_STORE))
+}
+
+// fileStore keeps each content in its own file of the given directory
+type fileStore struct {
+	dir string
+}
+
+func (fs *fileStore) Load(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path.Join(fs.dir, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+func (fs *fileStore) Save(name string, data []byte) error {
+	perm := os.FileMode(0700) // drwx------
+	if err := os.MkdirAll(path.Dir(path.Join(fs.dir, name)), perm); err != nil {
+		return err
+	}
+	perm = os.FileMode(0600) // -rw-------
+	return writeFileAtomic(path.Join(fs.dir, name), data, perm)
+}
+
+func (fs *fileStore) Delete(name string) error {
+	err := os.Remove(path.Join(fs.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// memoryStore keeps the contents in memory only
+type memoryStore struct {
+	lock     sync.Mutex
+	contents map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{contents: map[string][]byte{}}
+}
+
+func (ms *memoryStore) Load(name string) ([]byte, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	return ms.contents[name], nil
+}
+
+func (ms *memoryStore) Save(name string, data []byte) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	ms.contents[name] = data
+	return nil
+}
+
+func (ms *memoryStore) Delete(name string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	delete(ms.contents, name)
+	return nil
+}
+
+// envStore reads the contents from TASCLI_<NAME> environment variables (e.g. TASCLI_TOKEN holding the token JSON).
+// Environment can't be written back to, so whatever is saved is kept in memory and takes precedence afterwards.
+type envStore struct {
+	*memoryStore
+	deleted map[string]bool
+}
+
+func (es *envStore) Load(name string) ([]byte, error) {
+	if data, _ := es.memoryStore.Load(name); data != nil {
+		return data, nil
+	}
+	es.lock.Lock()
+	deleted := es.deleted[name]
+	es.lock.Unlock()
+	if deleted {
+		return nil, nil
+	}
+	if value := os.Getenv(envStoreVariable(name)); value != "" {
+		return []byte(value), nil
+	}
+	return nil, nil
+}
+
+func (es *envStore) Delete(name string) error {
+	es.lock.Lock()
+	if es.deleted == nil {
+		es.deleted = map[string]bool{}
+	}
+	es.deleted[name] = true
+	es.lock.Unlock()
+	return es.memoryStore.Delete(name)
+}
+
+// envStoreVariable returns the name of the environment variable holding the given content,
+// e.g. TASCLI_TOKEN or TASCLI_CONTEXTS_PROD_TOKEN for the token of the 'prod' context
+func envStoreVariable(name string) string {
+	return "TASCLI_" + strings.ToUpper(strings.NewReplacer("/", "_", "-", "_", ".", "_").Replace(name))
+}
+
+// Keyring is the OS keyring the keyring credential store keeps the contents in
+type Keyring interface {
+	// Get returns the secret of the given service & account, ErrKeyringNotFound if there's none
+	Get(service, account string) (string, error)
+
+	// Set stores the secret of the given service & account, replacing any previous one
+	Set(service, account, secret string) error
+
+	// Delete removes the secret of the given service & account, ErrKeyringNotFound if there's none
+	Delete(service, account string) error
+}
+
+// ErrKeyringNotFound tells the keyring has no secret for the given service & account
+var ErrKeyringNotFound = keyring.ErrNotFound
+
+// systemKeyring is the Secret Service over D-Bus on Linux (GNOME Keyring, KWallet...), the Keychain on macOS
+// and the Credential Manager on Windows
+type systemKeyring struct{}
+
+func (systemKeyring) Get(service, account string) (string, error) {
+	return keyring.Get(service, account)
+}
+
+func (systemKeyring) Set(service, account, secret string) error {
+	return keyring.Set(service, account, secret)
+}
+
+func (systemKeyring) Delete(service, account string) error {
+	return keyring.Delete(service, account)
+}
+
+// defaultKeyring is the keyring used by the keyring credential store
+var defaultKeyring Keyring = systemKeyring{}
+
+// keyringStore keeps the contents in the given keyring, under the 'tas-cli' service
+type keyringStore struct {
+	keyring Keyring
+}
+
+func (ks *keyringStore) Load(name string) ([]byte, error) {
+	secret, err := ks.keyring.Get(consts.CLI_MODULE_NAME, name)
+	if err == ErrKeyringNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ks.error("lookup", err)
+	}
+	return []byte(secret), nil
+}
+
+func (ks *keyringStore) Save(name string, data []byte) error {
+	if err := ks.keyring.Set(consts.CLI_MODULE_NAME, name, string(data)); err != nil {
+		return ks.error("store", err)
+	}
+	return nil
+}
+
+func (ks *keyringStore) Delete(name string) error {
+	if err := ks.keyring.Delete(consts.CLI_MODULE_NAME, name); err != nil && err != ErrKeyringNotFound {
+		return ks.error("clear", err)
+	}
+	return nil
+}
+
+func (ks *keyringStore) error(operation string, err error) error {
+	return errors.New(fmt.Sprintf("Keyring %s failed: %s", operation, err.Error()))
+}
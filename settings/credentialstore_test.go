@@ -0,0 +1,337 @@
+package settings
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Morphyni/tas-cli/consts"
+)
+
+// fakeKeyring is an in-memory Keyring
+type fakeKeyring struct {
+	lock    sync.Mutex
+	secrets map[string]string
+	err     error // returned by all operations when set
+}
+
+func newFakeKeyring() *fakeKeyring {
+	return &fakeKeyring{secrets: map[string]string{}}
+}
+
+func (fk *fakeKeyring) Get(service, account string) (string, error) {
+	fk.lock.Lock()
+	defer fk.lock.Unlock()
+	if fk.err != nil {
+		return "", fk.err
+	}
+	secret, ok := fk.secrets[service+"/"+account]
+	if !ok {
+		return "", ErrKeyringNotFound
+	}
+	return secret, nil
+}
+
+func (fk *fakeKeyring) Set(service, account, secret string) error {
+	fk.lock.Lock()
+	defer fk.lock.Unlock()
+	if fk.err != nil {
+		return fk.err
+	}
+	fk.secrets[service+"/"+account] = secret
+	return nil
+}
+
+func (fk *fakeKeyring) Delete(service, account string) error {
+	fk.lock.Lock()
+	defer fk.lock.Unlock()
+	if fk.err != nil {
+		return fk.err
+	}
+	if _, ok := fk.secrets[service+"/"+account]; !ok {
+		return ErrKeyringNotFound
+	}
+	delete(fk.secrets, service+"/"+account)
+	return nil
+}
+
+// useFakeKeyring makes the keyring credential store use the returned fake, until the returned function is called
+func useFakeKeyring() (*fakeKeyring, func()) {
+	fake := newFakeKeyring()
+	previous := defaultKeyring
+	defaultKeyring = fake
+	return fake, func() { defaultKeyring = previous }
+}
+
+func TestCredentialStores(t *testing.T) {
+	defer setupSettingsDir(t)()
+	_, restoreKeyring := useFakeKeyring()
+	defer restoreKeyring()
+
+	for _, backend := range []string{FILE_CREDENTIAL_STORE, MEMORY_CREDENTIAL_STORE, ENV_CREDENTIAL_STORE,
+		NONE_CREDENTIAL_STORE, KEYRING_CREDENTIAL_STORE} {
+		store, err := newCredentialStore(backend)
+		if err != nil {
+			t.Fatalf("%s: %v", backend, err)
+		}
+		for _, name := range []string{TOKEN_FILE_NAME, path.Join(CONTEXTS_DIR, "prod", SESSION_FILENAME)} {
+			if data, err := store.Load(name); err != nil || data != nil {
+				t.Errorf("%s: loading missing '%s' gave '%s', %v", backend, name, data, err)
+			}
+			if err = store.Save(name, []byte("first")); err != nil {
+				t.Fatalf("%s: saving '%s' failed: %v", backend, name, err)
+			}
+			if err = store.Save(name, []byte("second")); err != nil {
+				t.Fatalf("%s: saving '%s' again failed: %v", backend, name, err)
+			}
+			if data, err := store.Load(name); err != nil || string(data) != "second" {
+				t.Errorf("%s: loading '%s' gave '%s', %v, expected 'second'", backend, name, data, err)
+			}
+			if err = store.Delete(name); err != nil {
+				t.Errorf("%s: deleting '%s' failed: %v", backend, name, err)
+			}
+			if data, err := store.Load(name); err != nil || data != nil {
+				t.Errorf("%s: loading deleted '%s' gave '%s', %v", backend, name, data, err)
+			}
+			if err = store.Delete(name); err != nil {
+				t.Errorf("%s: deleting '%s' twice failed: %v", backend, name, err)
+			}
+		}
+	}
+}
+
+func TestUnknownCredentialStore(t *testing.T) {
+	if _, err := newCredentialStore("vault"); err == nil {
+		t.Error("Creating an unknown credential store should fail")
+	}
+}
+
+func TestFileCredentialStore(t *testing.T) {
+	defer setupSettingsDir(t)()
+
+	store, err := newCredentialStore(FILE_CREDENTIAL_STORE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := path.Join(CONTEXTS_DIR, "prod", TOKEN_FILE_NAME)
+	if err = store.Save(name, []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path.Join(settingsDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Credential file mode %v, expected -rw-------", info.Mode().Perm())
+	}
+}
+
+func TestEnvCredentialStore(t *testing.T) {
+	defer setupSettingsDir(t)()
+	defer setEnv(map[string]string{
+		"TASCLI_TOKEN":               "from environment",
+		"TASCLI_CONTEXTS_PROD_TOKEN": "prod from environment",
+	})()
+
+	store, err := newCredentialStore(ENV_CREDENTIAL_STORE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := store.Load(TOKEN_FILE_NAME); string(data) != "from environment" {
+		t.Errorf("Loaded '%s', expected the TASCLI_TOKEN value", data)
+	}
+	if data, _ := store.Load(path.Join(CONTEXTS_DIR, "prod", TOKEN_FILE_NAME)); string(data) != "prod from environment" {
+		t.Errorf("Loaded '%s', expected the TASCLI_CONTEXTS_PROD_TOKEN value", data)
+	}
+
+	// saved content takes precedence over the environment, which can't be written back to
+	if err = store.Save(TOKEN_FILE_NAME, []byte("saved")); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := store.Load(TOKEN_FILE_NAME); string(data) != "saved" {
+		t.Errorf("Loaded '%s', expected the saved value", data)
+	}
+	if os.Getenv("TASCLI_TOKEN") != "from environment" {
+		t.Error("Saving changed the environment")
+	}
+
+	// deleted content isn't read from the environment anymore
+	if err = store.Delete(TOKEN_FILE_NAME); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := store.Load(TOKEN_FILE_NAME); data != nil {
+		t.Errorf("Loaded '%s' once deleted, expected nothing", data)
+	}
+}
+
+func TestKeyringCredentialStoreErrors(t *testing.T) {
+	fake := newFakeKeyring()
+	fake.err = errors.New("no D-Bus session")
+	store := &keyringStore{keyring: fake}
+
+	if _, err := store.Load(TOKEN_FILE_NAME); err == nil || !strings.Contains(err.Error(), "no D-Bus session") {
+		t.Errorf("Loading gave '%v', expected the keyring error", err)
+	}
+	if err := store.Save(TOKEN_FILE_NAME, []byte("content")); err == nil || !strings.Contains(err.Error(), "no D-Bus session") {
+		t.Errorf("Saving gave '%v', expected the keyring error", err)
+	}
+	if err := store.Delete(TOKEN_FILE_NAME); err == nil || !strings.Contains(err.Error(), "no D-Bus session") {
+		t.Errorf("Deleting gave '%v', expected the keyring error", err)
+	}
+}
+
+// the session & token end up in the store selected by TASCLI_CREDENTIAL_STORE, never in the settings directory
+func TestTokenInCredentialStores(t *testing.T) {
+	for _, backend := range []string{MEMORY_CREDENTIAL_STORE, NONE_CREDENTIAL_STORE, ENV_CREDENTIAL_STORE, KEYRING_CREDENTIAL_STORE} {
+		func() {
+			defer setupSettingsDir(t)()
+			defer setEnv(map[string]string{consts.TASCLI_CREDENTIAL_STORE: backend})()
+			fake, restoreKeyring := useFakeKeyring()
+			defer restoreKeyring()
+
+			writeTestToken(t, "access-secret", "refresh-secret")
+			token, err := readTestToken(t)
+			if err != nil {
+				t.Fatalf("%s: %v", backend, err)
+			}
+			if token.AccessToken.Value != "access-secret" || token.RefreshToken.Value != "refresh-secret" {
+				t.Errorf("%s: read tokens '%s' & '%s', expected the written ones", backend, token.AccessToken.Value, token.RefreshToken.Value)
+			}
+			if fileExists(path.Join(settingsDir, TOKEN_FILE_NAME)) {
+				t.Errorf("%s: token written to the settings directory", backend)
+			}
+
+			if backend == KEYRING_CREDENTIAL_STORE {
+				secret, err := fake.Get(consts.CLI_MODULE_NAME, TOKEN_FILE_NAME)
+				if err != nil {
+					t.Fatalf("Token isn't in the keyring: %v", err)
+				}
+				if strings.Contains(secret, "access-secret") {
+					t.Errorf("Keyring holds the token in clear: %s", secret)
+				}
+			}
+		}()
+	}
+}
+
+// writeContextProfile writes the profile of the given context with the given credential store
+func writeContextProfile(t *testing.T, context, backend string) {
+	profile, err := newContextProfile(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile.CredentialStore = backend
+	if err = profile.Write(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// each context uses the credential store of its own profile, whichever context is in use
+func TestCredentialStorePerContext(t *testing.T) {
+	defer setupSettingsDir(t)()
+	fake, restoreKeyring := useFakeKeyring()
+	defer restoreKeyring()
+
+	writeContextProfile(t, "secure", KEYRING_CREDENTIAL_STORE)
+	writeContextProfile(t, "plain", FILE_CREDENTIAL_STORE)
+	for _, context := range []string{"secure", "plain"} {
+		if err := SetContext(context); err != nil {
+			t.Fatal(err)
+		}
+		writeTestToken(t, context+"-access", context+"-refresh")
+	}
+	keyringToken := path.Join(CONTEXTS_DIR, "secure", TOKEN_FILE_NAME)
+	if _, err := fake.Get(consts.CLI_MODULE_NAME, keyringToken); err != nil {
+		t.Errorf("Token of the keyring context isn't in the keyring: %v", err)
+	}
+	if !fileExists(path.Join(settingsDir, CONTEXTS_DIR, "plain", TOKEN_FILE_NAME)) {
+		t.Error("Token of the file context isn't in its directory")
+	}
+
+	// deleting the keyring context from the file one clears the keyring
+	if err := DeleteContext("secure"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fake.Get(consts.CLI_MODULE_NAME, keyringToken); err != ErrKeyringNotFound {
+		t.Errorf("Token of the deleted context left in the keyring: %v", err)
+	}
+
+	// and the other way around
+	writeContextProfile(t, "secure", KEYRING_CREDENTIAL_STORE)
+	if err := SetContext("secure"); err != nil {
+		t.Fatal(err)
+	}
+	writeTestToken(t, "secure-access", "secure-refresh")
+	if err := DeleteContext("plain"); err != nil {
+		t.Fatal(err)
+	}
+	if fileExists(path.Join(settingsDir, CONTEXTS_DIR, "plain")) {
+		t.Error("Directory of the deleted file context left behind")
+	}
+	if token, err := readTestToken(t); err != nil || token.AccessToken.Value != "secure-access" {
+		t.Errorf("Read %+v, %v, expected the keyring context's token", token, err)
+	}
+}
+
+// changing the credential store with 'config set' moves the session & token to the new one
+func TestMoveCredentials(t *testing.T) {
+	defer setupSettingsDir(t)()
+	fake, restoreKeyring := useFakeKeyring()
+	defer restoreKeyring()
+
+	writeTestToken(t, "access-secret", "refresh-secret")
+	key, err := GetConfigKey("credentialStore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := func(backend string) {
+		profile, err := NewProfile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = profile.Read(); err != nil {
+			t.Fatal(err)
+		}
+		previous := key.Get(profile)
+		if err = key.Set(profile, backend); err != nil {
+			t.Fatal(err)
+		}
+		if err = profile.Write(); err != nil {
+			t.Fatal(err)
+		}
+		if err = key.Apply(profile, previous); err != nil {
+			t.Fatalf("Moving to '%s' failed: %v", backend, err)
+		}
+	}
+
+	change(KEYRING_CREDENTIAL_STORE)
+	if fileExists(path.Join(settingsDir, TOKEN_FILE_NAME)) {
+		t.Error("Token left in the settings directory")
+	}
+	if _, err := fake.Get(consts.CLI_MODULE_NAME, TOKEN_FILE_NAME); err != nil {
+		t.Errorf("Token not moved to the keyring: %v", err)
+	}
+	if token, err := readTestToken(t); err != nil || token.AccessToken.Value != "access-secret" {
+		t.Errorf("Read %+v, %v, expected the moved token", token, err)
+	}
+
+	change(FILE_CREDENTIAL_STORE)
+	if _, err := fake.Get(consts.CLI_MODULE_NAME, TOKEN_FILE_NAME); err != ErrKeyringNotFound {
+		t.Errorf("Token left in the keyring: %v", err)
+	}
+	if token, err := readTestToken(t); err != nil || token.AccessToken.Value != "access-secret" {
+		t.Errorf("Read %+v, %v, expected the token moved back to its file", token, err)
+	}
+
+	// nothing can be kept in memory across commands, the token is cleared
+	change(MEMORY_CREDENTIAL_STORE)
+	if fileExists(path.Join(settingsDir, TOKEN_FILE_NAME)) {
+		t.Error("Token left in the settings directory")
+	}
+	if token, err := readTestToken(t); err != nil || token.AccessToken != nil {
+		t.Errorf("Read %+v, %v, expected no token", token, err)
+	}
+}
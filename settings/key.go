@@ -0,0 +1,137 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package settings
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KEY_FILENAME string = "key"
+	KEY_LENGTH          = 32 // AES-256
+
+	// how long a short key file is waited for before it's deemed corrupted
+	KEY_FILE_READ_ATTEMPTS = 20
+	KEY_FILE_READ_WAIT     = 50 * time.Millisecond
+)
+
+// salt used when deriving the key from a passphrase, it only has to be specific to this application
+var passphraseSalt = []byte("tas-cli.obfus_v2")
+
+// secretKey caches the key once loaded, it doesn't change during the life of the process
+var secretKey []byte
+
+// getSecretKey returns the key used to encrypt tokens & cookies at rest.
+// It's derived from the passphrase if one is given through the environment, else it's the random per-install key
+// kept in the settings directory, which is generated on first use.
+func getSecretKey() ([]byte, error) {
+	if secretKey != nil {
+		return secretKey, nil
+	}
+
+	if passphrase := os.Getenv(consts.TASCLI_PASSPHRASE); passphrase != "" {
+		key, err := scrypt.Key([]byte(passphrase), passphraseSalt, 1<<15, 8, 1, KEY_LENGTH)
+		if err != nil {
+			return nil, err
+		}
+		secretKey = key
+		return secretKey, nil
+	}
+
+	sf, err := newSharedSettingsFile(KEY_FILENAME)
+	if err != nil {
+		return nil, err
+	}
+
+	if sf.fileExists(sf.filePath) {
+		key, err := readKeyFile(sf.filePath)
+		if err != nil {
+			return nil, err
+		}
+		secretKey = key
+		return secretKey, nil
+	}
+
+	log.Debugf("Generating a new key into '%s'", sf.filePath)
+	key := make([]byte, KEY_LENGTH)
+	if _, err = io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err = sf.createSettingsDir(); err != nil {
+		return nil, err
+	}
+	if err = createKeyFile(sf.filePath, key); err != nil {
+		// another tas-cli process created one meanwhile, that one wins
+		if !sf.fileExists(sf.filePath) {
+			return nil, err
+		}
+		return getSecretKey()
+	}
+	secretKey = key
+	return secretKey, nil
+}
+
+// linkFile is os.Link, replaced in tests to play filesystems without hard links
+var linkFile = os.Link
+
+// createKeyFile creates the key file with the given key, failing if it exists already. The key is linked in place
+// from a temporary file so that it's never seen partially written. Filesystems without hard links (some FUSE, SMB or
+// container mounts) fall back to an exclusive create of the key file itself.
+func createKeyFile(filePath string, key []byte) error {
+	tmpPath := filePath + ".tmp" + strconv.Itoa(os.Getpid())
+	perm := os.FileMode(0600) // -rw-------
+	if err := writeFileAtomic(tmpPath, key, perm); err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	err := linkFile(tmpPath, filePath)
+	if err == nil || os.IsExist(err) {
+		return err
+	}
+
+	log.Debugf("Linking the key file failed, creating it in place: %s", err.Error())
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(key)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+	}
+	return err
+}
+
+// readKeyFile reads the key file, waiting a bit if it's short as another tas-cli process may be writing it in place
+func readKeyFile(filePath string) ([]byte, error) {
+	for i := 0; ; i++ {
+		key, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == KEY_LENGTH {
+			return key, nil
+		}
+		if len(key) > KEY_LENGTH || i == KEY_FILE_READ_ATTEMPTS {
+			return nil, errors.New(fmt.Sprintf("Key file '%s' is corrupted, delete it and log in again.", filePath))
+		}
+		time.Sleep(KEY_FILE_READ_WAIT)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+const (
+	LOCK_FILENAME string = ".lock"
+)
+
+// WithLock runs fn holding the advisory lock of the settings directory, so that read-modify-write cycles on the
+// settings of parallel tas-cli processes don't clobber each other. Calls must not be nested, and fn shouldn't do
+// anything slow like network calls while holding the lock.
+func WithLock(fn func() error) error {
+	unlock, err := lockSettings()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+// tryWithLock runs fn holding the advisory lock of the settings directory if it's available right away, and tells
+// whether fn was run. It's for writes which can be skipped, from code which may run within WithLock already.
+func tryWithLock(fn func() error) (bool, error) {
+	f, err := openLockFile()
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	locked, err := tryLockFile(f)
+	if err != nil || !locked {
+		return false, err
+	}
+	defer unlockFile(f)
+	return true, fn()
+}
+
+// WaitForWrites blocks until the read-modify-write cycles in progress on the settings, if any, are complete
+func WaitForWrites() {
+	dir, err := GetSettingsDir()
+	if err != nil || !fileExists(dir) {
+		return
+	}
+	WithLock(func() error { return nil })
+}
+
+// lockSettings blocks until it gets the advisory lock of the settings directory, and returns the function releasing it
+func lockSettings() (func(), error) {
+	f, err := openLockFile()
+	if err != nil {
+		return nil, err
+	}
+	if err = lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// openLockFile opens the file of the settings directory the advisory lock is taken on, creating it if needed
+func openLockFile() (*os.File, error) {
+	sf, err := newSharedSettingsFile(LOCK_FILENAME)
+	if err != nil {
+		return nil, err
+	}
+	if err = sf.createSettingsDir(); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(sf.filePath, os.O_RDWR|os.O_CREATE, 0600)
+}
+
+// writeFileAtomic writes data to a temporary file next to filePath and renames it over filePath,
+// so that readers never see a partially written file
+func writeFileAtomic(filePath string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := ioutil.TempFile(path.Dir(filePath), "."+path.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
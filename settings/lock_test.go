@@ -0,0 +1,157 @@
+package settings
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// parallel cookie refreshes, each taking the settings lock through its own file descriptor like separate
+// tas-cli processes would, must neither lose updates nor let readers see a partially written session
+func TestConcurrentCookieUpdates(t *testing.T) {
+	defer setupSettingsDir(t)()
+
+	const writers = 8
+	const updates = 20
+
+	session, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < writers; i++ {
+		session.Cookies = append(session.Cookies, &http.Cookie{Name: fmt.Sprintf("cookie-%d", i), Value: "0", Path: "/"})
+	}
+	if err = session.Write(true); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	readerErrors := make(chan error, 1)
+	go func() {
+		defer close(readerErrors)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			var content map[string]interface{}
+			bytes, err := ioutil.ReadFile(path.Join(settingsDir, SESSION_FILENAME))
+			if err == nil {
+				err = json.Unmarshal(bytes, &content)
+			}
+			if err != nil {
+				readerErrors <- err
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	updateErrors := make(chan error, writers*updates)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// every writer works from its own stale copy of the session
+			writer, err := NewSession()
+			if err != nil {
+				updateErrors <- err
+				return
+			}
+			for update := 1; update <= updates; update++ {
+				cookie := &http.Cookie{Name: fmt.Sprintf("cookie-%d", i), Value: strconv.Itoa(update), Path: "/"}
+				if err := writer.UpdateCookies([]*http.Cookie{cookie}, true); err != nil {
+					updateErrors <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(done)
+	close(updateErrors)
+
+	for err := range updateErrors {
+		t.Errorf("Updating cookies failed: %v", err)
+	}
+	if err := <-readerErrors; err != nil {
+		t.Errorf("Read a torn session file: %v", err)
+	}
+
+	read, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = read.Read(true); err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Cookies) != writers {
+		t.Fatalf("Session has %d cookies, expected %d", len(read.Cookies), writers)
+	}
+	for i, cookie := range read.Cookies {
+		if cookie.Name != fmt.Sprintf("cookie-%d", i) || cookie.Value != strconv.Itoa(updates) {
+			t.Errorf("Cookie %s=%s, expected cookie-%d=%d: an update got lost", cookie.Name, cookie.Value, i, updates)
+		}
+	}
+}
+
+// content migrated on read is only written back holding the settings lock, never while another read-modify-write
+// cycle is in progress
+func TestMigrationWriteBackTakesLock(t *testing.T) {
+	defer setupSettingsDir(t)()
+
+	legacy := `{"cookies":[{"Name":"idm","Value":"` + OBFUS_PREFIX_V1 + rot13("Idm-Secret") + `"}],"orgName":"acme"}`
+	writeRaw(t, SESSION_FILENAME, legacy)
+	readSession := func() {
+		session, err := NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = session.Read(true); err != nil {
+			t.Fatal(err)
+		}
+		if len(session.Cookies) != 1 || session.Cookies[0].Value != "Idm-Secret" || session.OrgName != "acme" {
+			t.Errorf("Read %+v, expected the migrated session", session)
+		}
+	}
+
+	// another process holds the lock
+	unlock, err := lockSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readSession()
+	unlock()
+	if readRaw(t, SESSION_FILENAME) != legacy {
+		t.Error("Migrated session written back while the settings were locked")
+	}
+
+	// reads within a read-modify-write cycle don't wait for the lock they're run under
+	done := make(chan error, 1)
+	go func() {
+		done <- WithLock(func() error {
+			readSession()
+			return nil
+		})
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reading within WithLock deadlocked")
+	}
+
+	readSession()
+	if raw := readRaw(t, SESSION_FILENAME); strings.Contains(raw, OBFUS_PREFIX_V1) || !strings.Contains(raw, `"schemaVersion":2`) {
+		t.Errorf("Migrated session not written back once the settings got unlocked: %s", raw)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+//go:build !windows
+// +build !windows
+
+package settings
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock on the given file, blocking until it's available
+func lockFile(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// tryLockFile takes an exclusive flock on the given file if it's available right away, and tells whether it did
+func tryLockFile(f *os.File) (bool, error) {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == syscall.EWOULDBLOCK {
+			return false, nil
+		}
+		if err != syscall.EINTR {
+			return err == nil, err
+		}
+	}
+}
+
+// unlockFile releases the flock taken on the given file
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+//go:build windows
+// +build windows
+
+package settings
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	LOCKFILE_FAIL_IMMEDIATELY = 0x00000001
+	LOCKFILE_EXCLUSIVE_LOCK   = 0x00000002
+	ERROR_LOCK_VIOLATION      = syscall.Errno(33)
+)
+
+// lockFile takes an exclusive lock on the first byte of the given file, blocking until it's available
+func lockFile(f *os.File) error {
+	overlapped := &syscall.Overlapped{}
+	r, _, err := procLockFileEx.Call(f.Fd(), LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// tryLockFile takes an exclusive lock on the first byte of the given file if it's available right away, and tells
+// whether it did
+func tryLockFile(f *os.File) (bool, error) {
+	overlapped := &syscall.Overlapped{}
+	r, _, err := procLockFileEx.Call(f.Fd(), LOCKFILE_EXCLUSIVE_LOCK|LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r == 0 {
+		if err == ERROR_LOCK_VIOLATION {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// unlockFile releases the lock taken on the given file
+func unlockFile(f *os.File) error {
+	overlapped := &syscall.Overlapped{}
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
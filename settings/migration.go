@@ -0,0 +1,144 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package settings
+
+import (
+	b "bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SCHEMA_VERSION is the version of the JSON layout of the settings files written by this tibcli.
+	// Bump it along with registering the migration from the previous version whenever the layout changes.
+	SCHEMA_VERSION = 2
+
+	// SCHEMA_VERSION_KEY is the JSON key holding the schema version, files without it are of version 1
+	SCHEMA_VERSION_KEY string = "schemaVersion"
+)
+
+// migration upgrades the decoded JSON content of a settings file from a schema version to the next one
+type migration func(content map[string]interface{}) error
+
+// migrations registers, per settings file name, the migration from each schema version to the next one
+var migrations = map[string]map[int]migration{
+	PROFILE_FILENAME: {
+		// credentialStore, timeout, requestTimeout & regions added, empty means the version 1 behavior
+		1: noChangeMigration,
+	},
+	SESSION_FILENAME: {
+		1: reobfuscateMigration("cookies"), // cookie values encrypted with AES-GCM instead of ROT13
+	},
+	TOKEN_FILE_NAME: {
+		// token values encrypted with AES-GCM instead of ROT13, RefreshToken added, absent until next login
+		1: reobfuscateMigration(ACCESS_TOKEN_KEY_NAME, REFRESH_TOKEN_KEY_NAME),
+	},
+}
+
+// MigrationError tells a settings file can't be migrated to the current schema, e.g. as it was written by a newer
+// tibcli. The only way out is to delete it and start from scratch.
+type MigrationError struct {
+	File        string
+	FromVersion int
+	ToVersion   int
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("No migration of settings file '%s' from schema version %d to %d.", e.File, e.FromVersion, e.ToVersion)
+}
+
+// noChangeMigration is for schema changes which only added optional fields
+func noChangeMigration(content map[string]interface{}) error {
+	return nil
+}
+
+// reobfuscateMigration rewrites with the current algorithm the ROT13 obfuscated values of the cookies held by
+// the given keys, each holding either a cookie or a list of cookies
+func reobfuscateMigration(keys ...string) migration {
+	return func(content map[string]interface{}) error {
+		for _, key := range keys {
+			var cookies []interface{}
+			switch value := content[key].(type) {
+			case []interface{}:
+				cookies = value
+			case map[string]interface{}:
+				cookies = []interface{}{value}
+			}
+			for _, c := range cookies {
+				cookie, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				value, ok := cookie["Value"].(string)
+				if !ok || !strings.HasPrefix(value, OBFUS_PREFIX_V1) {
+					continue
+				}
+				obfuscated, err := obfuscate(rot13(value[len(OBFUS_PREFIX_V1):]))
+				if err != nil {
+					return err
+				}
+				cookie["Value"] = obfuscated
+			}
+		}
+		return nil
+	}
+}
+
+// migrate upgrades the given content of the given settings file to the current schema version.
+// It returns whether the content was changed.
+func migrate(filename string, bytes []byte) ([]byte, bool, error) {
+	// keep numbers as they are, not going through float64
+	content := map[string]interface{}{}
+	decoder := json.NewDecoder(b.NewReader(bytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&content); err != nil {
+		return nil, false, err
+	}
+
+	version := 1
+	if value, ok := content[SCHEMA_VERSION_KEY].(json.Number); ok {
+		v, err := value.Int64()
+		if err != nil {
+			return nil, false, err
+		}
+		version = int(v)
+	}
+	if version == SCHEMA_VERSION {
+		return bytes, false, nil
+	}
+	if version > SCHEMA_VERSION {
+		return nil, false, &MigrationError{File: filename, FromVersion: version, ToVersion: SCHEMA_VERSION}
+	}
+
+	for ; version < SCHEMA_VERSION; version++ {
+		step, ok := migrations[filename][version]
+		if !ok {
+			return nil, false, &MigrationError{File: filename, FromVersion: version, ToVersion: SCHEMA_VERSION}
+		}
+		log.Debugf("Migrating settings file '%s' from schema version %d to %d", filename, version, version+1)
+		if err := step(content); err != nil {
+			return nil, false, err
+		}
+	}
+
+	content[SCHEMA_VERSION_KEY] = SCHEMA_VERSION
+	migrated, err := json.Marshal(content)
+	if err != nil {
+		return nil, false, err
+	}
+	return migrated, true, nil
+}
+
+// stampSchemaVersion adds the current schema version to the given serialized settings
+func stampSchemaVersion(bytes []byte) ([]byte, error) {
+	content := map[string]json.RawMessage{}
+	if err := json.Unmarshal(bytes, &content); err != nil {
+		return nil, err
+	}
+	content[SCHEMA_VERSION_KEY] = json.RawMessage(fmt.Sprint(SCHEMA_VERSION))
+	return json.Marshal(content)
+}
@@ -50,8 +50,15 @@ var PLACEHOLDER_VALUES = [...]string{
 	"$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$$",
 	"|||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||||"}
 
-//GetPlaceHolderValue returns placeholder value corresponding to the given placeholder type
+//GetPlaceHolderValue returns placeholder value corresponding to the given placeholder type,
+//as overridden by the config file, environment or flags if so, see ResolvePlaceHolder
 func GetPlaceHolderValue(placeholderType int) (error, string) {
+	resolution := ResolvePlaceHolder(placeholderType)
+	return resolution.Err, resolution.Value
+}
+
+//getPatchedPlaceHolderValue returns placeholder value patched into the binary corresponding to the given placeholder type
+func getPatchedPlaceHolderValue(placeholderType int) (error, string) {
 
 	// switch placeholderType {
 	// case USERNAME_PLACEHOLDER:
@@ -1,6 +1,9 @@
 package settings
 
-import "github.com/Morphyni/tas-cli/consts"
+import (
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/types"
+)
 
 const (
 	PROFILE_FILENAME string = "profile"
@@ -13,6 +16,13 @@ type Profile struct {
 	IDMConnectURL string `json:"idmConnectUrl"` // IDM server url
 	UserEmail     string `json:"userEmail"`     // user email
 	KnownRegion   string `json:"knownRegion"`   // known region
+	// backend keeping session & token, see CredentialStore. Files in the settings directory if empty
+	CredentialStore string `json:"credentialStore,omitempty"`
+	// overall deadline of the commands and timeout of every HTTP call, as Go durations (e.g. "5m"), see utils.SetTimeouts
+	Timeout        string `json:"timeout,omitempty"`
+	RequestTimeout string `json:"requestTimeout,omitempty"`
+	// regions the user's organizations are available in, as of the last IDM login
+	Regions []types.RegionUrlInfo `json:"regions,omitempty"`
 
 	// non-serializable (i.e. private) fields
 	*settingsFile // base type, containing all logic for serialization & deserialization
@@ -20,7 +30,12 @@ type Profile struct {
 
 // NewProfile creates a new Profile object.
 func NewProfile() (*Profile, error) {
-	settingsFile, err := newSettingsFile(PROFILE_FILENAME)
+	return newContextProfile(GetContext())
+}
+
+// newContextProfile creates a new Profile object belonging to the given context
+func newContextProfile(context string) (*Profile, error) {
+	settingsFile, err := newSharedSettingsFile(contextFilePath(context, PROFILE_FILENAME))
 	if err != nil {
 		return nil, err
 	}
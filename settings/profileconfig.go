@@ -0,0 +1,171 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConfigKey describes a user-level setting kept in the profile and editable with the 'config' command
+type ConfigKey struct {
+	Name        string
+	Description string
+	validate    func(p *Profile, value string) error
+	get         func(p *Profile) string
+	set         func(p *Profile, value string)
+	apply       func(p *Profile, previous string) error // optional, see Apply
+}
+
+// CONFIG_KEYS are all the settings editable with the 'config' command
+var CONFIG_KEYS = []ConfigKey{
+	{
+		Name:        "idmConnectUrl",
+		Description: "Identity-Management server URL, overriding the branded one",
+		validate:    validateURL,
+		get:         func(p *Profile) string { return p.IDMConnectURL },
+		set:         func(p *Profile, value string) { p.IDMConnectURL = value },
+	},
+	{
+		Name:        "userEmail",
+		Description: "Email of the user proposed on login",
+		validate:    validateEmail,
+		get:         func(p *Profile) string { return p.UserEmail },
+		set:         func(p *Profile, value string) { p.UserEmail = value },
+	},
+	{
+		Name:        "knownRegion",
+		Description: "Region of the user's organization",
+		validate:    validateRegion,
+		get:         func(p *Profile) string { return p.KnownRegion },
+		set:         func(p *Profile, value string) { p.KnownRegion = value },
+	},
+	{
+		Name:        "credentialStore",
+		Description: "Where session & token are kept: file, keyring, env, memory or none",
+		validate:    validateCredentialStore,
+		get:         func(p *Profile) string { return p.CredentialStore },
+		set:         func(p *Profile, value string) { p.CredentialStore = value },
+		apply:       moveCredentials,
+	},
+	{
+		Name:        "timeout",
+		Description: "Overall deadline of the commands, e.g. 5m; 0 for none",
+		validate:    validateDuration,
+		get:         func(p *Profile) string { return p.Timeout },
+		set:         func(p *Profile, value string) { p.Timeout = value },
+	},
+	{
+		Name:        "requestTimeout",
+		Description: "Timeout of every request to the servers, e.g. 30s; 0 for none",
+		validate:    validateDuration,
+		get:         func(p *Profile) string { return p.RequestTimeout },
+		set:         func(p *Profile, value string) { p.RequestTimeout = value },
+	},
+}
+
+// GetConfigKey returns the config key of the given name, case-insensitively
+func GetConfigKey(name string) (*ConfigKey, error) {
+	for i := range CONFIG_KEYS {
+		if strings.EqualFold(CONFIG_KEYS[i].Name, name) {
+			return &CONFIG_KEYS[i], nil
+		}
+	}
+	names := make([]string, len(CONFIG_KEYS))
+	for i, key := range CONFIG_KEYS {
+		names[i] = key.Name
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown config key '%s', valid ones are: %s.", name, strings.Join(names, ", ")))
+}
+
+// Get returns the value of the key in the given profile
+func (k *ConfigKey) Get(p *Profile) string {
+	return k.get(p)
+}
+
+// Set validates the given value and sets it in the given profile, the profile still has to be written
+func (k *ConfigKey) Set(p *Profile, value string) error {
+	if err := k.validate(p, value); err != nil {
+		return err
+	}
+	k.set(p, value)
+	return nil
+}
+
+// Unset clears the key in the given profile, the profile still has to be written
+func (k *ConfigKey) Unset(p *Profile) {
+	k.set(p, "")
+}
+
+// Apply carries out what changing the key from the given previous value implies, e.g. moving the session and token
+// to another credential store. It's called once the profile is written.
+func (k *ConfigKey) Apply(p *Profile, previous string) error {
+	if k.apply == nil {
+		return nil
+	}
+	return k.apply(p, previous)
+}
+
+func validateURL(p *Profile, value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid URL '%s': %s", value, err.Error()))
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New(fmt.Sprintf("Invalid URL '%s': an absolute http or https URL is expected.", value))
+	}
+	return nil
+}
+
+func validateEmail(p *Profile, value string) error {
+	if _, err := mail.ParseAddress(value); err != nil {
+		return errors.New(fmt.Sprintf("Invalid email '%s': %s", value, err.Error()))
+	}
+	return nil
+}
+
+// validateRegion checks the region is one the user's organizations are available in, as of the last login
+func validateRegion(p *Profile, value string) error {
+	known := map[string]bool{}
+	for _, region := range p.Regions {
+		known[region.Region] = true
+	}
+	if err, region := GetPlaceHolderValue(REGION_PLACEHOLDER); err == nil {
+		known[region] = true
+	}
+	if len(known) == 0 {
+		return errors.New("No region known yet, please log in first.")
+	}
+	if known[value] {
+		return nil
+	}
+
+	regions := make([]string, 0, len(known))
+	for region := range known {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return errors.New(fmt.Sprintf("Unknown region '%s', valid ones are: %s.", value, strings.Join(regions, ", ")))
+}
+
+func validateDuration(p *Profile, value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Invalid duration '%s', e.g. 30s or 5m is expected.", value))
+	}
+	if d < 0 {
+		return errors.New(fmt.Sprintf("Invalid duration '%s', it can't be negative.", value))
+	}
+	return nil
+}
+
+func validateCredentialStore(p *Profile, value string) error {
+	_, err := newCredentialStore(value)
+	return err
+}
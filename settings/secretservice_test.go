@@ -0,0 +1,286 @@
+//go:build linux
+// +build linux
+
+package settings
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretServiceName   = "org.freedesktop.secrets"
+	secretServicePath   = "/org/freedesktop/secrets"
+	secretCollection    = "/org/freedesktop/secrets/collection/login"
+	secretSession       = "/org/freedesktop/secrets/session/1"
+	secretServicePrefix = "org.freedesktop.Secret."
+	noPrompt            = dbus.ObjectPath("/")
+)
+
+// busConfig is the configuration of the private session bus the fake Secret Service runs on
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:tmpdir=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`
+
+// secret is the Secret structure of the Secret Service API
+type secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// fakeSecretService implements the part of the Secret Service API used by the keyring library, with a single
+// unlocked 'login' collection and plain sessions
+type fakeSecretService struct {
+	conn  *dbus.Conn
+	lock  sync.Mutex
+	items map[dbus.ObjectPath]*fakeSecretItem
+	count int
+}
+
+type fakeSecretItem struct {
+	service    *fakeSecretService
+	path       dbus.ObjectPath
+	attributes map[string]string
+	secret     []byte
+}
+
+// startFakeSecretService starts a private session bus running a fake Secret Service, and returns the address of
+// the bus along with the function stopping it. The test is skipped if dbus-daemon isn't installed.
+func startFakeSecretService(t *testing.T) (*fakeSecretService, string, func()) {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found, can't run a private session bus")
+	}
+	dir, err := ioutil.TempDir("", "tas-cli-dbus-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := path.Join(dir, "session.conf")
+	if err = ioutil.WriteFile(configFile, []byte(fmt.Sprintf(busConfig, dir)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+configFile, "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+	}
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		stop()
+		t.Fatalf("No address printed by dbus-daemon: %v", err)
+	}
+	address = strings.TrimSpace(address)
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		stop()
+		t.Fatal(err)
+	}
+	fs := &fakeSecretService{conn: conn, items: map[dbus.ObjectPath]*fakeSecretItem{}}
+	exports := []struct {
+		v     interface{}
+		path  dbus.ObjectPath
+		iface string
+	}{
+		{fs, secretServicePath, secretServicePrefix + "Service"},
+		{fakeProperties{fs}, secretServicePath, "org.freedesktop.DBus.Properties"},
+		{fakeCollection{fs}, secretCollection, secretServicePrefix + "Collection"},
+		{fakeSession{}, secretSession, secretServicePrefix + "Session"},
+	}
+	for _, export := range exports {
+		if err = conn.Export(export.v, export.path, export.iface); err != nil {
+			stop()
+			t.Fatal(err)
+		}
+	}
+	if reply, err := conn.RequestName(secretServiceName, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		stop()
+		t.Fatalf("Can't own '%s': %v", secretServiceName, err)
+	}
+	return fs, address, func() {
+		conn.Close()
+		stop()
+	}
+}
+
+func (fs *fakeSecretService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.MakeVariant(""), "", dbus.MakeFailedError(fmt.Errorf("unsupported algorithm '%s'", algorithm))
+	}
+	return dbus.MakeVariant(""), secretSession, nil
+}
+
+func (fs *fakeSecretService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	return objects, noPrompt, nil
+}
+
+// secrets returns the secrets kept, by 'service/username' attributes
+func (fs *fakeSecretService) secrets() map[string]string {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	secrets := map[string]string{}
+	for _, item := range fs.items {
+		secrets[item.attributes["service"]+"/"+item.attributes["username"]] = string(item.secret)
+	}
+	return secrets
+}
+
+type fakeProperties struct {
+	fs *fakeSecretService
+}
+
+func (fp fakeProperties) Get(iface, property string) (dbus.Variant, *dbus.Error) {
+	if iface == secretServicePrefix+"Service" && property == "Collections" {
+		return dbus.MakeVariant([]dbus.ObjectPath{secretCollection}), nil
+	}
+	return dbus.MakeVariant(""), dbus.MakeFailedError(fmt.Errorf("unknown property %s.%s", iface, property))
+}
+
+type fakeCollection struct {
+	fs *fakeSecretService
+}
+
+func (fc fakeCollection) CreateItem(properties map[string]dbus.Variant, s secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	attributes, ok := properties[secretServicePrefix+"Item.Attributes"].Value().(map[string]string)
+	if !ok {
+		return "", "", dbus.MakeFailedError(fmt.Errorf("no attributes"))
+	}
+	fs := fc.fs
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if replace {
+		for _, item := range fs.items {
+			if matchesAttributes(item.attributes, attributes) && len(item.attributes) == len(attributes) {
+				item.secret = s.Value
+				return item.path, noPrompt, nil
+			}
+		}
+	}
+	fs.count++
+	item := &fakeSecretItem{service: fs, path: dbus.ObjectPath(fmt.Sprintf("%s/%d", secretCollection, fs.count)),
+		attributes: attributes, secret: s.Value}
+	if err := fs.conn.Export(item, item.path, secretServicePrefix+"Item"); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	fs.items[item.path] = item
+	return item.path, noPrompt, nil
+}
+
+func (fc fakeCollection) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	fc.fs.lock.Lock()
+	defer fc.fs.lock.Unlock()
+	results := []dbus.ObjectPath{}
+	for _, item := range fc.fs.items {
+		if matchesAttributes(item.attributes, attributes) {
+			results = append(results, item.path)
+		}
+	}
+	return results, nil
+}
+
+func (fi *fakeSecretItem) GetSecret(session dbus.ObjectPath) (secret, *dbus.Error) {
+	fi.service.lock.Lock()
+	defer fi.service.lock.Unlock()
+	return secret{Session: session, Parameters: []byte{}, Value: fi.secret, ContentType: "text/plain"}, nil
+}
+
+func (fi *fakeSecretItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	fs := fi.service
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	delete(fs.items, fi.path)
+	fs.conn.Export(nil, fi.path, secretServicePrefix+"Item")
+	return noPrompt, nil
+}
+
+type fakeSession struct{}
+
+func (fakeSession) Close() *dbus.Error {
+	return nil
+}
+
+// matchesAttributes tells whether the given attributes hold all searched ones
+func matchesAttributes(attributes, search map[string]string) bool {
+	for name, value := range search {
+		if attributes[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// the keyring credential store talks to the Secret Service over D-Bus on Linux
+func TestSystemKeyring(t *testing.T) {
+	fake, address, stop := startFakeSecretService(t)
+	defer stop()
+	defer setEnv(map[string]string{"DBUS_SESSION_BUS_ADDRESS": address})()
+
+	store := &keyringStore{keyring: systemKeyring{}}
+	name := path.Join(CONTEXTS_DIR, "prod", TOKEN_FILE_NAME)
+	if data, err := store.Load(name); err != nil || data != nil {
+		t.Fatalf("Loading missing '%s' gave '%s', %v", name, data, err)
+	}
+	if err := store.Save(name, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(name, []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if secrets := fake.secrets(); len(secrets) != 1 || secrets[consts.CLI_MODULE_NAME+"/"+name] != "second" {
+		t.Errorf("Secret Service holds %v, expected the last saved content under the tas-cli service", secrets)
+	}
+	if data, err := store.Load(name); err != nil || string(data) != "second" {
+		t.Errorf("Loaded '%s', %v, expected 'second'", data, err)
+	}
+	if err := store.Delete(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(name); err != nil {
+		t.Errorf("Deleting twice failed: %v", err)
+	}
+	if data, err := store.Load(name); err != nil || data != nil {
+		t.Errorf("Loaded '%s', %v once deleted, expected nothing", data, err)
+	}
+
+	// the token written with the keyring credential store ends up encrypted in the Secret Service
+	defer setupSettingsDir(t)()
+	defer setEnv(map[string]string{consts.TASCLI_CREDENTIAL_STORE: KEYRING_CREDENTIAL_STORE})()
+	writeTestToken(t, "access-secret", "refresh-secret")
+	if token, err := readTestToken(t); err != nil || token.AccessToken.Value != "access-secret" {
+		t.Errorf("Read %+v, %v, expected the written token", token, err)
+	}
+	secret, ok := fake.secrets()[consts.CLI_MODULE_NAME+"/"+TOKEN_FILE_NAME]
+	if !ok || strings.Contains(secret, "access-secret") {
+		t.Errorf("Secret Service holds the token '%s', expected it encrypted", secret)
+	}
+}
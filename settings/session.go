@@ -33,6 +33,9 @@ type Session struct {
 	OrgList        []types.OrgEntry `json:"orgList"`
 	SubscriptionId string           `json:"subscriptionId"`
 
+	// Identity-Management server the session belongs to, the one of the selected region for multi-org users
+	IdmUrl string `json:"idmUrl,omitempty"`
+
 	// following fields come from DomainServer GetDefaultSandbox response
 	DefaultSandboxName           string `json:"defaultSandboxName"`
 	DefaultSandboxOrganizationId string `json:"defaultSandboxOrgId"`
@@ -45,7 +48,7 @@ type Session struct {
 
 // NewSession creates a new Session object.
 func NewSession() (*Session, error) {
-	settingsFile, err := newSettingsFile(SESSION_FILENAME)
+	settingsFile, err := newCredentialSettingsFile(SESSION_FILENAME)
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +64,9 @@ func (s *Session) Read(unobfuscateValue bool) (err error) {
 	} else {
 		if unobfuscateValue && s.Cookies != nil {
 			for _, cookie := range s.Cookies {
-				cookie.Value = unobfuscate(cookie.Value)
+				if cookie.Value, err = unobfuscate(cookie.Value); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -78,12 +83,9 @@ func (s *Session) Write(obfuscateValue bool) error {
 		var newCookies []*http.Cookie
 		for _, cookie := range s.Cookies {
 			// override the Cookie value in the copy with an obfuscated value
-			newCookie := &http.Cookie{
-				Name:    cookie.Name,
-				Value:   obfuscate(cookie.Value),
-				Path:    cookie.Path,
-				Domain:  cookie.Domain,
-				Expires: cookie.Expires,
+			newCookie, err := obfuscateCookie(cookie)
+			if err != nil {
+				return err
 			}
 			newCookies = append(newCookies, newCookie)
 		}
@@ -100,29 +102,50 @@ func (s *Session) Delete() error {
 }
 
 // UpdateCookies will update session existing cookies with new values, optionally obfuscating the cookie's value.
+// The session is re-read from disk under the settings lock before being updated, so that parallel tas-cli
+// processes refreshing cookies don't overwrite each other's changes.
 func (s *Session) UpdateCookies(newCookies []*http.Cookie, obfuscateValue bool) error {
 
-	log.Debugf("[UpdateCookies] obfuscate %+v, \n newCookies: %+v, \n s.Cookies(old Cookies): %+v", obfuscateValue, newCookies, s.Cookies)
+	log.Debugf("[UpdateCookies] obfuscate %+v, \n newCookies: %v, \n s.Cookies(old Cookies): %v", obfuscateValue, cookieNames(newCookies), cookieNames(s.Cookies))
 
 	if newCookies == nil || len(newCookies) == 0 {
-		log.Errorf("[UpdateCookies] new cookies value is empty: %+v", newCookies)
+		log.Errorf("[UpdateCookies] new cookies value is empty: %v", cookieNames(newCookies))
 		return errors.New("[UpdateCookies] The given new cookes are empty")
 	}
-	if s.Cookies == nil || len(s.Cookies) == 0 { //first time set Cookies
-		s.Cookies = newCookies
-	} else {
-		for _, newCookie := range newCookies {
-			for i, oldCookie := range s.Cookies {
-				if oldCookie.Name == newCookie.Name && oldCookie.Domain == newCookie.Domain && oldCookie.Path == newCookie.Path {
-					log.Debugf("[UpdateCookies] Cookie '%s' get refreshed.", newCookie.Name)
-					s.Cookies[i] = newCookie
+
+	return WithLock(func() error {
+		// merge into the latest state of the session, another process may have updated it since it was read
+		latest := &Session{settingsFile: s.settingsFile}
+		if err := latest.Read(obfuscateValue); err != nil {
+			return err
+		}
+
+		if latest.Cookies == nil || len(latest.Cookies) == 0 { //first time set Cookies
+			latest.Cookies = newCookies
+		} else {
+			for _, newCookie := range newCookies {
+				for i, oldCookie := range latest.Cookies {
+					if oldCookie.Name == newCookie.Name && oldCookie.Domain == newCookie.Domain && oldCookie.Path == newCookie.Path {
+						log.Debugf("[UpdateCookies] Cookie '%s' get refreshed.", newCookie.Name)
+						latest.Cookies[i] = newCookie
+					}
 				}
 			}
 		}
-	}
-	log.Debugf("Session cookies refreshed, new values: %+v", s.Cookies)
+		log.Debugf("Session cookies refreshed: %v", cookieNames(latest.Cookies))
 
-	s.Write(obfuscateValue)
+		s.Cookies = latest.Cookies
+		return latest.Write(obfuscateValue)
+	})
+}
 
-	return nil
+// cookieNames returns the names of the given cookies, their values mustn't be logged
+func cookieNames(cookies []*http.Cookie) []string {
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		if cookie != nil {
+			names = append(names, cookie.Name)
+		}
+	}
+	return names
 }
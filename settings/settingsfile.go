@@ -5,29 +5,51 @@
 package settings
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/user"
 	"path"
+	"path/filepath"
 	"strings"
+
+	"github.com/Morphyni/tas-cli/consts"
+	log "github.com/sirupsen/logrus"
 )
 
 const (
 	SETTINGS_DIR = ".tibcli"
+	//Name of the settings directory within $XDG_CONFIG_HOME
+	XDG_SETTINGS_DIR = "tas-cli"
+	XDG_CONFIG_HOME  = "XDG_CONFIG_HOME"
 	//Prefix put in front of obfuscated strings indicating the algorithm
-	OBFUS_PREFIX string = "obfus_v1."
+	OBFUS_PREFIX string = "obfus_v2."
+	//Prefix of strings obfuscated by older tibcli versions with ROT13, still readable but rewritten on next write
+	OBFUS_PREFIX_V1 string = "obfus_v1."
 )
 
 // Struct settingsFile is the base type for all files in the storage.  It contains methods for
 // reading/writing the profile to disk. Any setting file implementation should extend this.
 type settingsFile struct {
 	filePath string
+	relPath  string          // path relative to the settings directory, it's the name used in the credential store
+	store    CredentialStore // when set, the content is kept there rather than in filePath
 }
 
-// newSettingsFile creates a new settingsFile object
+// newSettingsFile creates a new settingsFile object belonging to the current context
 func newSettingsFile(filename string) (*settingsFile, error) {
-	sf := &settingsFile{}
+	return newSharedSettingsFile(contextFilePath(GetContext(), filename))
+}
+
+// newSharedSettingsFile creates a new settingsFile object directly in the settings directory, shared by all contexts
+func newSharedSettingsFile(filename string) (*settingsFile, error) {
+	sf := &settingsFile{relPath: filename}
 
 	// compute profile filepath
 	filePath, err := sf.getFilePath(filename)
@@ -38,13 +60,108 @@ func newSettingsFile(filename string) (*settingsFile, error) {
 	return sf, nil
 }
 
-// getSettingsDir returns the full path to the settings directory
-func (sf *settingsFile) getSettingsDir() (string, error) {
+// newCredentialSettingsFile creates a new settingsFile object for settings holding secrets,
+// they're kept in the configured credential store
+func newCredentialSettingsFile(filename string) (*settingsFile, error) {
+	context := GetContext()
+	sf, err := newSharedSettingsFile(contextFilePath(context, filename))
+	if err != nil {
+		return nil, err
+	}
+	if sf.store, err = getCredentialStore(context); err != nil {
+		return nil, err
+	}
+	return sf, nil
+}
+
+// name returns the name of the settings file relative to the settings directory (e.g. "profile", "contexts/prod/session", etc.)
+func (sf *settingsFile) name() string {
+	return sf.relPath
+}
+
+// settingsDir is the resolved settings directory, see GetSettingsDir
+var settingsDir string
+
+// SetSettingsDir overrides the settings directory for this process, e.g. with the --config-dir flag
+func SetSettingsDir(dir string) error {
+	if dir == "" {
+		return errors.New("The settings directory can't be empty.")
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	settingsDir = absDir
+	return nil
+}
+
+// GetSettingsDir returns the full path to the settings directory, looking in order at SetSettingsDir,
+// the TASCLI_HOME environment variable and $XDG_CONFIG_HOME/tas-cli, falling back to ~/.tibcli.
+// When $XDG_CONFIG_HOME is set, an existing ~/.tibcli gets moved there the first time.
+func GetSettingsDir() (string, error) {
+	if settingsDir != "" {
+		return settingsDir, nil
+	}
+	if dir := os.Getenv(consts.TASCLI_HOME); dir != "" {
+		if err := SetSettingsDir(dir); err != nil {
+			return "", err
+		}
+		return settingsDir, nil
+	}
+
+	legacyDir := ""
+	if homeDir, err := getHomeDir(); err == nil {
+		legacyDir = path.Join(homeDir, SETTINGS_DIR)
+	} else if os.Getenv(XDG_CONFIG_HOME) == "" {
+		return "", err
+	}
+
+	if xdgConfigHome := os.Getenv(XDG_CONFIG_HOME); xdgConfigHome != "" {
+		xdgDir := path.Join(xdgConfigHome, XDG_SETTINGS_DIR)
+		if legacyDir != "" && fileExists(legacyDir) && !fileExists(xdgDir) {
+			if err := migrateSettingsDir(legacyDir, xdgDir); err != nil {
+				log.Debugf("Migrating settings from '%s' to '%s' failed, keep using the former: %s", legacyDir, xdgDir, err.Error())
+				settingsDir = legacyDir
+				return settingsDir, nil
+			}
+		}
+		settingsDir = xdgDir
+		return settingsDir, nil
+	}
+
+	settingsDir = legacyDir
+	return settingsDir, nil
+}
+
+// getHomeDir returns the current user's home directory, from $HOME first as there may be no passwd entry
+// for the user (e.g. in containers)
+func getHomeDir() (string, error) {
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		return homeDir, nil
+	}
 	u, err := user.Current()
 	if err != nil {
 		return "", err
 	}
-	return path.Join(u.HomeDir, SETTINGS_DIR), nil
+	return u.HomeDir, nil
+}
+
+// migrateSettingsDir moves the legacy settings directory to its new location
+func migrateSettingsDir(legacyDir, newDir string) error {
+	perm := os.FileMode(0700) // drwx------
+	if err := os.MkdirAll(path.Dir(newDir), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(legacyDir, newDir); err != nil {
+		return err
+	}
+	log.Infof("Settings moved from '%s' to '%s'.", legacyDir, newDir)
+	return nil
+}
+
+// getSettingsDir returns the full path to the settings directory
+func (sf *settingsFile) getSettingsDir() (string, error) {
+	return GetSettingsDir()
 }
 
 // getFilePath returns the full path to the given settings filename
@@ -60,17 +177,19 @@ func (sf *settingsFile) getFilePath(filename string) (string, error) {
 
 // fileExists returns true if the specifield file exists
 func (sf *settingsFile) fileExists(filePath string) bool {
+	return fileExists(filePath)
+}
+
+// fileExists returns true if the specifield file exists
+func fileExists(filePath string) bool {
 	_, err := os.Stat(filePath)
 	return !os.IsNotExist(err)
 }
 
-// createSettingsDir create the settings directory if it does not exist. If
-// it exists, it is a no-op
+// createSettingsDir create the settings directory (or the context directory in it) holding the file if it does
+// not exist. If it exists, it is a no-op
 func (sf *settingsFile) createSettingsDir() error {
-	settingsDir, err := sf.getSettingsDir()
-	if err != nil {
-		return err
-	}
+	settingsDir := path.Dir(sf.filePath)
 
 	if !sf.fileExists(settingsDir) {
 		perm := os.FileMode(0700) // drwx------
@@ -79,7 +198,7 @@ func (sf *settingsFile) createSettingsDir() error {
 	return nil
 }
 
-// write serializes the supplied object to the settings file on disk
+// write serializes the supplied object to the settings file on disk, stamped with the current schema version
 // in is the struct that is to be serialized
 func (sf *settingsFile) write(in interface{}) error {
 	// marshal the current receiver to a slice of bytes
@@ -87,49 +206,167 @@ func (sf *settingsFile) write(in interface{}) error {
 	if err != nil {
 		return err
 	}
+	if bytes, err = stampSchemaVersion(bytes); err != nil {
+		return err
+	}
+	return sf.writeBytes(bytes)
+}
+
+// writeBytes saves the given serialized content to the credential store if any, else to the settings file on disk
+func (sf *settingsFile) writeBytes(bytes []byte) error {
+	if sf.store != nil {
+		return sf.store.Save(sf.name(), bytes)
+	}
 
 	// create directory (if needed)
-	err = sf.createSettingsDir()
+	err := sf.createSettingsDir()
 	if err != nil {
 		return err
 	}
 
 	// create file
 	perm := os.FileMode(0600) // -rw-------
-	if err = ioutil.WriteFile(sf.filePath, bytes, perm); err != nil {
+	if err = writeFileAtomic(sf.filePath, bytes, perm); err != nil {
 		return err
 	}
 	return nil
 }
 
-// read deserializes the content of the settings file from disk into the supplied object
+// read deserializes the content of the settings file from disk into the supplied object.
+// Content written with an older schema gets migrated and saved back first.
 // out is the struct where the file will be de-serialized into
 func (sf *settingsFile) read(out interface{}) error {
-	// read content from file (if exists)
-	if sf.fileExists(sf.filePath) {
-		bytes, err := ioutil.ReadFile(sf.filePath)
-		if err != nil {
-			return err
+	bytes, err := sf.readBytes()
+	if err != nil || len(bytes) == 0 {
+		return err
+	}
+
+	migrated, changed, err := migrate(path.Base(sf.relPath), bytes)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err = sf.saveMigrated(); err != nil {
+			log.Debugf("Saving migrated '%s' failed, it will be migrated again next time: %s", sf.name(), err.Error())
 		}
+	}
 
-		// unmarshal the file content to the current receiver
-		if err = json.Unmarshal(bytes, out); err != nil {
+	// unmarshal the file content to the current receiver
+	return json.Unmarshal(migrated, out)
+}
+
+// saveMigrated migrates and writes back the content of the settings file under the settings lock, unless another
+// process did meanwhile. It's skipped when the lock is taken, e.g. by the read-modify-write cycle of the caller which
+// writes the migrated content anyway, or else it simply gets migrated again next time.
+func (sf *settingsFile) saveMigrated() error {
+	locked, err := tryWithLock(func() error {
+		bytes, err := sf.readBytes()
+		if err != nil || len(bytes) == 0 {
+			return err
+		}
+		migrated, changed, err := migrate(path.Base(sf.relPath), bytes)
+		if err != nil || !changed {
 			return err
 		}
+		return sf.writeBytes(migrated)
+	})
+	if err == nil && !locked {
+		log.Debugf("Settings locked, '%s' will be migrated again next time", sf.name())
 	}
-	return nil
+	return err
+}
+
+// readBytes loads the serialized content from the credential store if any, else from the settings file on disk.
+// Nothing is returned if there's no content yet.
+func (sf *settingsFile) readBytes() ([]byte, error) {
+	if sf.store != nil {
+		return sf.store.Load(sf.name())
+	}
+
+	// read content from file (if exists)
+	if sf.fileExists(sf.filePath) {
+		return ioutil.ReadFile(sf.filePath)
+	}
+	return nil, nil
 }
 
 // deleteFile deletes settingsFile if it exists
 func (sf *settingsFile) deleteFile() error {
+	if sf.store != nil {
+		return sf.store.Delete(sf.name())
+	}
 	if sf.fileExists(sf.filePath) {
 		return os.Remove(sf.filePath)
 	}
 	return nil
 }
 
-func obfuscate(s string) string {
-	return OBFUS_PREFIX + rot13(s)
+// UnobfuscateError tells an obfuscated value can't be decrypted, e.g. as the key file got lost, TASCLI_PASSPHRASE
+// changed or the value was tampered with. The only way out is to delete the settings holding it and log in again.
+type UnobfuscateError struct {
+	Reason string
+}
+
+func (e *UnobfuscateError) Error() string {
+	return "Obfuscated value " + e.Reason
+}
+
+// IsUnobfuscateError tells whether the given error is due to an obfuscated value which can't be decrypted
+func IsUnobfuscateError(err error) bool {
+	var unobfuscateErr *UnobfuscateError
+	return errors.As(err, &unobfuscateErr)
+}
+
+// obfuscate encrypts the given string with AES-GCM, the result is prefixed with the algorithm version
+func obfuscate(s string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(s), nil)
+	return OBFUS_PREFIX + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// unobfuscate decrypts strings produced by obfuscate, the legacy ROT13 ones get rewritten by the schema migration.
+// Strings without a known prefix are returned as is.
+func unobfuscate(obf string) (string, error) {
+	if !strings.HasPrefix(obf, OBFUS_PREFIX) {
+		return obf, nil
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(obf[len(OBFUS_PREFIX):])
+	if err != nil {
+		return "", &UnobfuscateError{Reason: "is corrupted: " + err.Error()}
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", &UnobfuscateError{Reason: "is truncated."}
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", &UnobfuscateError{Reason: "can't be decrypted, the key was changed or the value was tampered with."}
+	}
+	return string(plain), nil
+}
+
+// newGCM creates the AES-GCM cipher keyed with the install's secret key
+func newGCM() (cipher.AEAD, error) {
+	key, err := getSecretKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
 }
 
 func rot13(s string) string {
@@ -145,11 +382,3 @@ func rot13(s string) string {
 	}
 	return o
 }
-
-func unobfuscate(obf string) string {
-	if strings.HasPrefix(obf, OBFUS_PREFIX) {
-		return rot13(obf[len(OBFUS_PREFIX):]) //we're doing ROT13; just strip the versioning prefix
-	} else {
-		return obf
-	}
-}
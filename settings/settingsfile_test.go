@@ -0,0 +1,320 @@
+package settings
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+)
+
+// setupSettingsDir points the settings to a new temporary directory, dropping whatever the package cached about the
+// previous one, and returns the function cleaning it up
+func setupSettingsDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "tas-cli-settings-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoreEnv := setEnv(map[string]string{
+		consts.TASCLI_PASSPHRASE:       "",
+		consts.TASCLI_CREDENTIAL_STORE: "",
+		consts.TASCLI_CONTEXT:          "",
+	})
+	resetCaches()
+	settingsDir = dir
+	return func() {
+		resetCaches()
+		restoreEnv()
+		os.RemoveAll(dir)
+	}
+}
+
+// resetCaches drops the settings directory, key, credential store & co. the package caches for the life of the process
+func resetCaches() {
+	settingsDir = ""
+	secretKey = nil
+	credentialStores = nil
+	configFile = nil
+	selectedContext = ""
+}
+
+// setEnv sets the given environment variables and returns the function restoring them
+func setEnv(values map[string]string) func() {
+	previous := map[string]string{}
+	for name, value := range values {
+		previous[name] = os.Getenv(name)
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, value := range previous {
+			os.Setenv(name, value)
+		}
+	}
+}
+
+// readRaw returns the raw content of the given settings file
+func readRaw(t *testing.T, filename string) string {
+	bytes, err := ioutil.ReadFile(path.Join(settingsDir, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bytes)
+}
+
+// writeRaw replaces the content of the given settings file
+func writeRaw(t *testing.T, filename, content string) {
+	if err := ioutil.WriteFile(path.Join(settingsDir, filename), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestToken(t *testing.T, access, refresh string) {
+	token, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.AccessToken = &http.Cookie{Name: ACCESS_TOKEN_KEY_NAME, Value: access, Expires: time.Now().Add(time.Hour).UTC()}
+	token.RefreshToken = &http.Cookie{Name: REFRESH_TOKEN_KEY_NAME, Value: refresh}
+	if err = token.Write(true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestToken(t *testing.T) (*Token, error) {
+	token, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, token.Read(true)
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	defer setupSettingsDir(t)()
+
+	session, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	session.Cookies = []*http.Cookie{
+		{Name: "first", Value: "first-secret", Path: "/", Domain: "example.com", Expires: expires},
+		{Name: "second", Value: "second-secret"},
+	}
+	session.UserName = "jack@example.com"
+	session.OrgName = "acme"
+	if err = session.Write(true); err != nil {
+		t.Fatal(err)
+	}
+
+	raw := readRaw(t, SESSION_FILENAME)
+	if strings.Contains(raw, "first-secret") || strings.Contains(raw, "second-secret") {
+		t.Errorf("Session file holds cookie values in clear: %s", raw)
+	}
+	if strings.Count(raw, OBFUS_PREFIX) != 2 {
+		t.Errorf("Session cookie values aren't obfuscated with '%s': %s", OBFUS_PREFIX, raw)
+	}
+
+	read, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = read.Read(true); err != nil {
+		t.Fatal(err)
+	}
+	if read.UserName != session.UserName || read.OrgName != session.OrgName || len(read.Cookies) != 2 {
+		t.Fatalf("Read session %+v, expected %+v", read, session)
+	}
+	for i, cookie := range session.Cookies {
+		got := read.Cookies[i]
+		if got.Name != cookie.Name || got.Value != cookie.Value || got.Path != cookie.Path || got.Domain != cookie.Domain ||
+			!got.Expires.Equal(cookie.Expires) {
+			t.Errorf("Read cookie %+v, expected %+v", got, cookie)
+		}
+	}
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	defer setupSettingsDir(t)()
+
+	writeTestToken(t, "access-secret", "refresh-secret")
+
+	raw := readRaw(t, TOKEN_FILE_NAME)
+	if strings.Contains(raw, "access-secret") || strings.Contains(raw, "refresh-secret") {
+		t.Errorf("Token file holds tokens in clear: %s", raw)
+	}
+
+	token, err := readTestToken(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken.Value != "access-secret" || token.RefreshToken.Value != "refresh-secret" {
+		t.Errorf("Read tokens '%s' & '%s', expected the written ones", token.AccessToken.Value, token.RefreshToken.Value)
+	}
+}
+
+func TestObfuscationIsRandomized(t *testing.T) {
+	defer setupSettingsDir(t)()
+
+	first, err := obfuscate("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := obfuscate("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("Obfuscating the same value twice gave the same '%s', the nonce isn't random", first)
+	}
+}
+
+func TestLegacyObfuscationMigration(t *testing.T) {
+	defer setupSettingsDir(t)()
+
+	// files written by older tibcli: ROT13 values and no schema version
+	writeRaw(t, TOKEN_FILE_NAME, `{"AccessToken":{"Name":"AccessToken","Value":"`+OBFUS_PREFIX_V1+rot13("Access-Secret")+`"}}`)
+	writeRaw(t, SESSION_FILENAME, `{"cookies":[{"Name":"idm","Value":"`+OBFUS_PREFIX_V1+rot13("Session-Secret")+`"}],"orgName":"acme"}`)
+
+	token, err := readTestToken(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken.Value != "Access-Secret" {
+		t.Errorf("Read legacy access token '%s', expected 'Access-Secret'", token.AccessToken.Value)
+	}
+	session, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.Read(true); err != nil {
+		t.Fatal(err)
+	}
+	if len(session.Cookies) != 1 || session.Cookies[0].Value != "Session-Secret" || session.OrgName != "acme" {
+		t.Errorf("Read legacy session %+v, expected the 'Session-Secret' cookie of 'acme'", session)
+	}
+
+	// both got rewritten with the current algorithm
+	for _, filename := range []string{TOKEN_FILE_NAME, SESSION_FILENAME} {
+		raw := readRaw(t, filename)
+		if strings.Contains(raw, OBFUS_PREFIX_V1) || !strings.Contains(raw, OBFUS_PREFIX) {
+			t.Errorf("'%s' wasn't rewritten with '%s': %s", filename, OBFUS_PREFIX, raw)
+		}
+	}
+	token, err = readTestToken(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken.Value != "Access-Secret" {
+		t.Errorf("Read migrated access token '%s', expected 'Access-Secret'", token.AccessToken.Value)
+	}
+}
+
+func TestTamperedValue(t *testing.T) {
+	defer setupSettingsDir(t)()
+
+	writeTestToken(t, "access-secret", "refresh-secret")
+	raw := readRaw(t, TOKEN_FILE_NAME)
+
+	// flip a character in the middle of the access token ciphertext, the last one may only hold padding bits
+	start := strings.Index(raw, OBFUS_PREFIX)
+	end := start + strings.Index(raw[start:], `"`)
+	middle := (start + len(OBFUS_PREFIX) + end) / 2
+	replacement := "A"
+	if raw[middle] == 'A' {
+		replacement = "B"
+	}
+	writeRaw(t, TOKEN_FILE_NAME, raw[:middle]+replacement+raw[middle+1:])
+
+	if _, err := readTestToken(t); !IsUnobfuscateError(err) {
+		t.Errorf("Reading a tampered token gave '%v', expected an UnobfuscateError", err)
+	}
+
+	writeRaw(t, TOKEN_FILE_NAME, raw[:start+len(OBFUS_PREFIX)]+`"`+raw[end+1:])
+	if _, err := readTestToken(t); !IsUnobfuscateError(err) {
+		t.Errorf("Reading a truncated token gave '%v', expected an UnobfuscateError", err)
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	defer setupSettingsDir(t)()
+	defer setEnv(map[string]string{consts.TASCLI_PASSPHRASE: "first passphrase"})()
+
+	writeTestToken(t, "access-secret", "refresh-secret")
+	if _, err := readTestToken(t); err != nil {
+		t.Fatalf("Reading with the same passphrase failed: %v", err)
+	}
+
+	os.Setenv(consts.TASCLI_PASSPHRASE, "second passphrase")
+	secretKey = nil
+	if _, err := readTestToken(t); !IsUnobfuscateError(err) {
+		t.Errorf("Reading with another passphrase gave '%v', expected an UnobfuscateError", err)
+	}
+}
+
+func TestLostKeyFile(t *testing.T) {
+	defer setupSettingsDir(t)()
+
+	writeTestToken(t, "access-secret", "refresh-secret")
+	if err := os.Remove(path.Join(settingsDir, KEY_FILENAME)); err != nil {
+		t.Fatal(err)
+	}
+	secretKey = nil
+
+	if _, err := readTestToken(t); !IsUnobfuscateError(err) {
+		t.Errorf("Reading without the key gave '%v', expected an UnobfuscateError", err)
+	}
+}
+
+func TestKeyFileWithoutHardLinks(t *testing.T) {
+	defer setupSettingsDir(t)()
+	defer func() { linkFile = os.Link }()
+	linkFile = func(oldname, newname string) error {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: errors.New("operation not supported")}
+	}
+
+	writeTestToken(t, "access-secret", "refresh-secret")
+	info, err := os.Stat(path.Join(settingsDir, KEY_FILENAME))
+	if err != nil {
+		t.Fatalf("No key file created: %v", err)
+	}
+	if info.Size() != KEY_LENGTH {
+		t.Errorf("Key file of %d bytes, expected %d", info.Size(), KEY_LENGTH)
+	}
+	secretKey = nil
+	token, err := readTestToken(t)
+	if err != nil || token.AccessToken.Value != "access-secret" {
+		t.Errorf("Read back %+v, %v, expected the token written with the created key", token, err)
+	}
+	files, _ := ioutil.ReadDir(settingsDir)
+	for _, file := range files {
+		if strings.Contains(file.Name(), ".tmp") {
+			t.Errorf("Temporary file '%s' left behind", file.Name())
+		}
+	}
+}
+
+func TestKeyFileCreatedMeanwhile(t *testing.T) {
+	defer setupSettingsDir(t)()
+	defer func() { linkFile = os.Link }()
+
+	// another process creates the key file while this one generates its own
+	otherKey := []byte(strings.Repeat("k", KEY_LENGTH))
+	linkFile = func(oldname, newname string) error {
+		if err := ioutil.WriteFile(newname, otherKey, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return errors.New("operation not supported")
+	}
+	key, err := getSecretKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != string(otherKey) {
+		t.Error("The key of the other process wasn't used")
+	}
+}
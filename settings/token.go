@@ -6,14 +6,16 @@ package settings
 import "net/http"
 
 const (
-	TOKEN_FILE_NAME              = "token"
-	ACCESS_TOKEN_KEY_NAME string = "AccessToken"
+	TOKEN_FILE_NAME               = "token"
+	ACCESS_TOKEN_KEY_NAME  string = "AccessToken"
+	REFRESH_TOKEN_KEY_NAME string = "RefreshToken"
 )
 
 // The following Token struct present 'token' file which locates in '~/.tibcli' folder and it contains TA accessToken
 type Token struct {
 	// serializable fields
-	AccessToken *http.Cookie // AccessToken keeps TA accessToken after TA login passed
+	AccessToken  *http.Cookie // AccessToken keeps TA accessToken after TA login passed
+	RefreshToken *http.Cookie `json:",omitempty"` // RefreshToken keeps TA refreshToken used to renew the accessToken
 
 	// non-serializable (i.e. private) fields
 	*settingsFile // base type, containing all logic for serialization & deserialization
@@ -21,7 +23,7 @@ type Token struct {
 
 // NewToken creates a new token object.
 func NewToken() (*Token, error) {
-	settingsFile, err := newSettingsFile(TOKEN_FILE_NAME)
+	settingsFile, err := newCredentialSettingsFile(TOKEN_FILE_NAME)
 	if err != nil {
 		return nil, err
 	}
@@ -36,33 +38,56 @@ func (t *Token) Read(unobfuscateValue bool) (err error) {
 		return err
 	} else {
 		if unobfuscateValue && t.AccessToken != nil {
-			t.AccessToken.Value = unobfuscate(t.AccessToken.Value)
+			if t.AccessToken.Value, err = unobfuscate(t.AccessToken.Value); err != nil {
+				return err
+			}
+		}
+		if unobfuscateValue && t.RefreshToken != nil {
+			if t.RefreshToken.Value, err = unobfuscate(t.RefreshToken.Value); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
 // Write saves the current object to disk.
-func (t *Token) Write(obfuscateValue bool) error {
+func (t *Token) Write(obfuscateValue bool) (err error) {
 
-	if obfuscateValue && t.AccessToken != nil {
+	if obfuscateValue && (t.AccessToken != nil || t.RefreshToken != nil) {
 		// create a copy of s, to preserve the rest of the fields
 		var s_obfus *Token = new(Token)
 		*s_obfus = *t
-		newCookie := &http.Cookie{
-			Name:    s_obfus.AccessToken.Name,
-			Value:   obfuscate(s_obfus.AccessToken.Value),
-			Path:    s_obfus.AccessToken.Path,
-			Domain:  s_obfus.AccessToken.Domain,
-			Expires: s_obfus.AccessToken.Expires,
+		if s_obfus.AccessToken, err = obfuscateCookie(t.AccessToken); err != nil { //Override the cookie
+			return err
+		}
+		if s_obfus.RefreshToken, err = obfuscateCookie(t.RefreshToken); err != nil { //Override the cookie
+			return err
 		}
-		s_obfus.AccessToken = newCookie //Override the cookie
 		return t.write(s_obfus)
 	} else {
 		return t.write(t)
 	}
 }
 
+// obfuscateCookie returns a copy of the given cookie with an obfuscated value, nil if the cookie is nil
+func obfuscateCookie(cookie *http.Cookie) (*http.Cookie, error) {
+	if cookie == nil {
+		return nil, nil
+	}
+	value, err := obfuscate(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Cookie{
+		Name:    cookie.Name,
+		Value:   value,
+		Path:    cookie.Path,
+		Domain:  cookie.Domain,
+		Expires: cookie.Expires,
+	}, nil
+}
+
 // Deletes this token file from disk.
 func (t *Token) Delete() error {
 	return t.deleteFile()
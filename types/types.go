@@ -2,10 +2,12 @@ package types
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"net/http"
 	"net/url"
+	"time"
 
-	"git.tibco.com/git/product/troposphere/golib.git/atmos/utilities"
 	"github.com/urfave/cli"
 )
 
@@ -324,6 +326,8 @@ type FollowupRequest struct {
 	Token,
 	ClientId,
 	ClientSecret string
+	// TokenTypeHint tells which kind of token is revoked on logout, access_token if empty
+	TokenTypeHint string
 }
 
 // ResourceConstraints contains resource constraints for an application instance
@@ -361,11 +365,35 @@ type BuildServerResponse struct {
 }
 
 type RestCallRequest struct {
-	Method       string                  // REST method
-	Url          *url.URL                // URL of the Rest API to be invoked
-	Headers      map[string]string       // HTTP Headers to be passed while invoking the API
-	Body         io.Reader               // Request body for the API
-	LogRequest   bool                    // if true; then the rest handler will log the request otherwise will skip it
-	UserId       string                  // user Id used for logging
-	RetryAttempt *utilities.RetryAttempt // retry times if connection failed
+	Context      context.Context   // cancels the call when done, context.Background() if nil
+	Service      string            // name of the called service used in errors, the host of Url if empty
+	Method       string            // REST method
+	Url          *url.URL          // URL of the Rest API to be invoked
+	Headers      map[string]string // HTTP Headers to be passed while invoking the API
+	Body         io.Reader         // Request body for the API
+	LogRequest   bool              // if true; then the rest handler will log the request otherwise will skip it
+	UserId       string            // user Id used for logging
+	RetryAttempt *RetryAttempt     // retry policy, a single attempt if nil
+}
+
+// RetryAttempt is the retry policy of a REST call: how many more times it's attempted when the connection to the
+// server fails or the server is unavailable (429, 502, 503, 504), and how long to wait between attempts
+type RetryAttempt struct {
+	Count              int           // attempts after the first one
+	Interval           time.Duration // base wait, doubled after each attempt
+	MaxWait            time.Duration // upper bound of a single wait, Retry-After included; no bound if zero
+	Jitter             float64       // fraction of the wait randomly added or removed, e.g. 0.2 for +/-20%
+	RetryNonIdempotent bool          // also retry methods like POST when the server may have processed the request
+}
+
+// RestCallResponse is the outcome of a REST call
+type RestCallResponse struct {
+	HttpCode      int            // HTTP status code, HTTP_CONNECTION_ERROR_CODE if the server couldn't be reached
+	Status        string         // HTTP status line
+	Headers       http.Header    // response headers
+	Cookies       []*http.Cookie // cookies set by the response
+	ResponseBytes []byte         // response body
+	ErrorResponse *ErrorResponse // set if the call failed, decoded from the body when the server sent one
+	Attempts      int            // number of attempts it took
+	Duration      time.Duration  // time taken by all attempts
 }
@@ -10,9 +10,11 @@ import (
 	"github.com/Morphyni/tas-cli/consts"
 )
 
-// GetDomainServerGetSandboxesAPI returns REST API path for Domain-Server to get all sandboxes including operational
+// The ids are escaped as single path segments, the paths returned are to be set as the RawPath of the URLs.
+
+// GetDomainServerGetOpSandboxesAPI returns REST API path for Domain-Server to get all sandboxes of the organization including operational
 func GetDomainServerGetOpSandboxesAPI() string {
-	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_ORG_SANDBOXES_API
 }
 
 // GetWebServerFeatureAPI returns REST API path for Domain-Server login
@@ -22,22 +24,22 @@ func GetWebServerFeatureAPI() string {
 
 // GetDomainServerGetAppAPI returns REST API path for Domain-Server get app
 func GetDomainServerGetAppAPI(sandboxId string) string {
-	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + sandboxId + "/applications"
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + "/applications"
 }
 
 // GetDomainServerGetAppDetailsAPI returns REST API path for Domain-Server get app details
 func GetDomainServerGetAppDetailsAPI(sandboxId string, appId string) string {
-	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + sandboxId + "/applications/" + appId
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + "/applications/" + url.PathEscape(appId)
 }
 
 // GetDomainServerGetAppConfigAPI returns REST API path for Domain-Server get app configuration
 func GetDomainServerGetAppConfigAPI(sandboxId, appId string) string {
-	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + sandboxId + "/applications/" + appId + "/configuration"
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + "/applications/" + url.PathEscape(appId) + "/configuration"
 }
 
 // GetDomainServerListAppsAPI returns REST API path for Domain-Server List Apps
 func GetDomainServerListAppsAPI(sandboxId string) string {
-	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + sandboxId + "/applications"
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + "/applications"
 }
 
 // GetDomainServerListAllAppsAPI returns REST API path for Domain-Server List All Apps
@@ -45,6 +47,11 @@ func GetDomainServerListAllAppsAPI() string {
 	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + "/applications"
 }
 
+// GetDomainServerGetAppByIdAPI returns REST API path for Domain-Server get app by its id, whatever its sandbox
+func GetDomainServerGetAppByIdAPI(appId string) string {
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + "/applications/" + url.PathEscape(appId)
+}
+
 // GetDomainServerGetSandboxesAPI returns REST API path for Domain-Server get all sandboxes
 func GetDomainServerGetSandboxesAPI() string {
 	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API
@@ -57,27 +64,27 @@ func GetDomainServerDefaultSandboxAPI() string {
 
 // GetDomainServerGetSandboxAPI returns REST API path for Domain-Server get a sandbox
 func GetDomainServerGetSandboxAPI(sandboxId string) string {
-	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + sandboxId
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + url.PathEscape(sandboxId)
 }
 
 // GetDomainServerGetAppEndpoint returns REST API path for Domain-Server get endpoint
 func GetDomainServerGetAppEndpointAPI(sandboxId string, applicationId string, endpointId string) string {
-	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + sandboxId + "/applications/" + applicationId + "/endpoints/" + endpointId
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + "/applications/" + url.PathEscape(applicationId) + "/endpoints/" + url.PathEscape(endpointId)
 }
 
 // GetDomainServerGetAppEndpointURL returns REST API path for Domain-Server get endpoint URL
 func GetDomainServerGetAppEndpointURLAPI(sandboxId string, applicationId string, endpointId string) string {
-	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + sandboxId + "/applications/" + applicationId + "/endpoints/" + endpointId + "/url"
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + "/applications/" + url.PathEscape(applicationId) + "/endpoints/" + url.PathEscape(endpointId) + "/url"
 }
 
 // GetDomainServerFetchAppAuditsAPI returns REST API path for Domain-Server fetch app audit history URL
 func GetDomainServerFetchAppAuditsAPI(applicationId string) string {
-	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + "/audits/" + applicationId
+	return consts.DOMAIN_SERVER_CONTEXT_PATH + consts.DOMAIN_SERVER_API_VERSION + "/audits/" + url.PathEscape(applicationId)
 }
 
 // GetAppManagerNewAppsAPI returns REST API path for App-Manager to start new application
 func GetAppManagerNewAppsAPI(appId string) string {
-	return consts.APP_MANAGER_CONTEXT_PATH + consts.APP_MANAGER_API_VERSION + consts.APP_MANAGER_APPS_API + "/" + appId
+	return consts.APP_MANAGER_CONTEXT_PATH + consts.APP_MANAGER_API_VERSION + consts.APP_MANAGER_APPS_API + "/" + url.PathEscape(appId)
 }
 
 // GetOrchestratorSandboxAPI returns REST API path for Orchestrator to push application
@@ -87,22 +94,22 @@ func GetOrchestratorSandboxAPI() string {
 
 // GetOrchestratorPushAPI returns REST API path for Orchestrator to push application
 func GetOrchestratorPushAPI(sandboxId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + sandboxId + consts.ORCHESTRATOR_APPS_API
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + consts.ORCHESTRATOR_APPS_API
 }
 
 // GetOrchestratorMoveAppAPI returns REST API path for Orchestrator to move application from one sandbox to another
 func GetOrchestratorMoveAppAPI(sandboxId, appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + sandboxId + "/applications/" + appId + "/target"
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + "/applications/" + url.PathEscape(appId) + "/target"
 }
 
 // GetOrchestratorPromoteAppAPI returns REST API path for Orchestrator to promote application to operational sandbox
 func GetOrchestratorPromoteAppAPI(sandboxId, appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + sandboxId + "/applications/" + appId + "/promote"
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + "/applications/" + url.PathEscape(appId) + "/promote"
 }
 
 // GetOrchestratorCopyAppAPI copies app
 func GetOrchestratorCopyAppAPI(appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + "/applications/" + appId + "/copy"
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + "/applications/" + url.PathEscape(appId) + "/copy"
 }
 
 // GetOrchestratorUpgradeAppAPI returns REST API path for Orchestrator to upgrade application to with another application from operational sandbox
@@ -112,37 +119,37 @@ func GetOrchestratorUpgradeAppAPI() string {
 
 // GetOrchestratorReplaceAppAPI returns REST API path for Orchestrator to replace application with another application
 func GetOrchestratorReplaceAppAPI(appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + "/applications/" + appId + "/replace"
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + "/applications/" + url.PathEscape(appId) + "/replace"
 }
 
 // GetOrchestratorUpdateAppAPI returns REST API path for Orchestrator to update application attributes with given values
 func GetOrchestratorUpdateAppAPI(sandboxId, appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + sandboxId + "/applications/" + appId
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + "/applications/" + url.PathEscape(appId)
 }
 
 // GetOrchestratorUpdateApplicationAPI returns REST API path for Orchestrator to update application visibility
 func GetOrchestratorUpdateAppVisibilityAPI(appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_APPLICATIONS_API + "/" + appId
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_APPLICATIONS_API + "/" + url.PathEscape(appId)
 }
 
 // GetOrchestratorConfigureAPI returns REST API path for Orchestrator to configure application property overrides
 func GetOrchestratorConfigureAPI(sandboxId, appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + sandboxId + consts.ORCHESTRATOR_APPS_API + "/" + appId + consts.ORCHESTRATOR_CONFIGURATION_API
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + consts.ORCHESTRATOR_APPS_API + "/" + url.PathEscape(appId) + consts.ORCHESTRATOR_CONFIGURATION_API
 }
 
 // GetOrchestratorDeleteAPI returns REST API path for Orchestrator to delete application
 func GetOrchestratorDeleteAPI(sandboxId, appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + sandboxId + consts.ORCHESTRATOR_APPS_API + "/" + appId
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + consts.ORCHESTRATOR_APPS_API + "/" + url.PathEscape(appId)
 }
 
 // GetOrchestratorStatusAPI returns REST API path for Orchestrator to get application status
 func GetOrchestratorStatusAPI(sandboxId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + sandboxId + consts.ORCHESTRATOR_APPS_API + consts.ORCHESTRATOR_STATUS_API
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + consts.ORCHESTRATOR_APPS_API + consts.ORCHESTRATOR_STATUS_API
 }
 
 // GetOrchestratorScaleAPI returns REST API path for Orchestrator to scale application
 func GetOrchestratorScaleAPI(sandboxId, appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + sandboxId + consts.ORCHESTRATOR_APPS_API + "/" + appId + consts.ORCHESTRATOR_INSTANCES_API
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_SANDBOXES_API + "/" + url.PathEscape(sandboxId) + consts.ORCHESTRATOR_APPS_API + "/" + url.PathEscape(appId) + consts.ORCHESTRATOR_INSTANCES_API
 }
 
 // GetBuildServerPushBWSupplementAPI return API path for BuildServer to push supplement
@@ -157,12 +164,12 @@ func GetAppLogCreateQueryAPI() string {
 
 // GetAppLogGetLogsAPI returns REST API path for AppLog to fetch application logs.
 func GetAppLogGetLogsAPI(queryId string) string {
-	return consts.APPLOG_CONTEXT_PATH + consts.APPLOG_VERSION + consts.APPLOG_QUERY_API + "/" + queryId
+	return consts.APPLOG_CONTEXT_PATH + consts.APPLOG_VERSION + consts.APPLOG_QUERY_API + "/" + url.PathEscape(queryId)
 }
 
 // GetAppLogDeleteQueryAPI returns REST API path for AppLog to delete a log query.
 func GetAppLogDeleteQueryAPI(queryId string) string {
-	return consts.APPLOG_CONTEXT_PATH + consts.APPLOG_VERSION + consts.APPLOG_QUERY_API + "/" + queryId
+	return consts.APPLOG_CONTEXT_PATH + consts.APPLOG_VERSION + consts.APPLOG_QUERY_API + "/" + url.PathEscape(queryId)
 }
 
 // GetIdentityManagementLoginAPI returns REST API path for Identity-Management login
@@ -170,9 +177,14 @@ func GetIdentityManagementLoginAPI() string {
 	return consts.IDENTITY_MANAGEMENT_CONTEXT_PATH + consts.IDENTITY_MANAGEMENT_API_VERSION + consts.IDENTITY_MANAGEMENT_LOGIN_API
 }
 
+// GetIdentityManagementLogoutAPI returns REST API path for Identity-Management logout
+func GetIdentityManagementLogoutAPI() string {
+	return consts.IDENTITY_MANAGEMENT_CONTEXT_PATH + consts.IDENTITY_MANAGEMENT_API_VERSION + consts.IDENTITY_MANAGEMENT_LOGOUT_API
+}
+
 // GetFTLStatus method gets FTL Status of a sandbox from Atmosphere(Orchestrator)
 func GetFTLStatus(sandboxId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_FTL_STATUS + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + sandboxId
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + consts.ORCHESTRATOR_FTL_STATUS + consts.DOMAIN_SERVER_SANDBOXES_API + "/" + url.PathEscape(sandboxId)
 }
 
 // GetOrchestratorEnableDisableOrgFTLAPI returns REST API path for Orchestrator to enable/disable FTL
@@ -192,12 +204,12 @@ func GetAcessKeysAPI() string {
 
 // GetUpdateAppAccessKeyAPI returns API path for update accessKey for app
 func GetUpdateAppAccessKeyAPI(sandboxId, appId, accessKey string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + "/sandboxes/" + sandboxId + "/applications/" + appId + "/tibTunnelAccessKey/" + accessKey
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + "/sandboxes/" + url.PathEscape(sandboxId) + "/applications/" + url.PathEscape(appId) + "/tibTunnelAccessKey/" + url.PathEscape(accessKey)
 }
 
 // GetRemoveAppAccessKeyAPI returns API path for remove accessKey from app
 func GetRemoveAppAccessKeyAPI(sandboxId, appId string) string {
-	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + "/sandboxes/" + sandboxId + "/applications/" + appId + "/tibTunnelAccessKey"
+	return consts.ORCHESTRATOR_CONTEXT_PATH + consts.ORCHESTRATOR_API_VERSION + "/sandboxes/" + url.PathEscape(sandboxId) + "/applications/" + url.PathEscape(appId) + "/tibTunnelAccessKey"
 }
 
 // ResolveAppLogServerURL returns the base URL for AppLogServer REST API
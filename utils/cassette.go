@@ -0,0 +1,181 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+	log "github.com/sirupsen/logrus"
+)
+
+// CASSETTE_FILENAME is the name of the HAR file TASCLI_RECORD records to within its directory
+const CASSETTE_FILENAME = "cassette.har"
+
+var (
+	replayer         *replayTransport
+	cassetteRecorder *harRecorder
+)
+
+// ConfigureCassettes enables the replay mode if TASCLI_REPLAY is set, serving responses from the HAR files it points
+// to instead of the network, and the record mode if TASCLI_RECORD is set, appending the traffic to the HAR file of
+// its directory. HAR files recorded with --record-http can be replayed as well.
+func ConfigureCassettes() error {
+	replayer = nil
+	if replayPath := os.Getenv(consts.TASCLI_REPLAY); replayPath != "" {
+		entries, err := readCassettes(replayPath)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Can't replay the HAR files of '%s': %s", replayPath, err.Error()))
+		}
+		log.Debugf("Replaying %d recorded requests from '%s', the network isn't used", len(entries), replayPath)
+		replayer = &replayTransport{entries: entries, used: make([]bool, len(entries))}
+	}
+
+	if dir := os.Getenv(consts.TASCLI_RECORD); dir != "" {
+		perm := os.FileMode(0700) // drwx------
+		if err := os.MkdirAll(dir, perm); err != nil {
+			return errors.New(fmt.Sprintf("Can't record to '%s': %s", dir, err.Error()))
+		}
+		// successive commands of a scenario go to the same HAR file
+		filePath := path.Join(dir, CASSETTE_FILENAME)
+		var entries []harEntry
+		har, err := readHar(filePath)
+		if err == nil {
+			entries = har.Log.Entries
+		} else if !os.IsNotExist(err) {
+			return errors.New(fmt.Sprintf("Can't record to '%s': %s", filePath, err.Error()))
+		}
+		if cassetteRecorder, err = newHarRecorder(filePath, entries); err != nil {
+			return errors.New(fmt.Sprintf("Can't record to '%s': %s", filePath, err.Error()))
+		}
+	}
+	return nil
+}
+
+// IsReplaying tells whether the responses are served from HAR files instead of the network, see ConfigureCassettes
+func IsReplaying() bool {
+	return replayer != nil
+}
+
+// readCassettes returns the entries of the given HAR file, or of all HAR files of the given directory in name order
+func readCassettes(replayPath string) ([]harEntry, error) {
+	info, err := os.Stat(replayPath)
+	if err != nil {
+		return nil, err
+	}
+	filePaths := []string{replayPath}
+	if info.IsDir() {
+		files, err := ioutil.ReadDir(replayPath)
+		if err != nil {
+			return nil, err
+		}
+		filePaths = nil
+		for _, file := range files {
+			if !file.IsDir() && strings.HasSuffix(file.Name(), ".har") {
+				filePaths = append(filePaths, path.Join(replayPath, file.Name()))
+			}
+		}
+		if len(filePaths) == 0 {
+			return nil, errors.New("No HAR file found.")
+		}
+	}
+
+	var entries []harEntry
+	for _, filePath := range filePaths {
+		har, err := readHar(filePath)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Reading '%s' failed: %s", filePath, err.Error()))
+		}
+		entries = append(entries, har.Log.Entries...)
+	}
+	return entries, nil
+}
+
+// replayTransport is the http.RoundTripper serving the responses recorded in HAR files. Requests are matched on
+// method and URL only, their bodies carry secrets like passwords which are redacted in the recording.
+type replayTransport struct {
+	mutex   sync.Mutex
+	entries []harEntry
+	used    []bool
+}
+
+// RoundTrip serves the first unused recorded response to a request with the same method and URL, the last one
+// being served again once they're all used
+func (t *replayTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body != nil {
+		request.Body.Close()
+	}
+	// sensitive query parameters are masked as in the recording
+	url := RedactString(request.URL.String())
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	match := -1
+	for i, entry := range t.entries {
+		if entry.Request.Method != request.Method || entry.Request.URL != url {
+			continue
+		}
+		match = i
+		if !t.used[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, errors.New(fmt.Sprintf("No recorded response to %s %s", request.Method, url))
+	}
+	t.used[match] = true
+
+	entry := t.entries[match]
+	if entry.Response.Status == 0 {
+		log.Debugf("Replaying failure of %s %s: %s", request.Method, url, entry.Error)
+		return nil, errors.New(entry.Error)
+	}
+	log.Debugf("Replaying %d response to %s %s", entry.Response.Status, request.Method, url)
+	return newReplayedResponse(request, entry.Response), nil
+}
+
+// newReplayedResponse rebuilds the recorded response. Its cookies are set again, with the masked values they were
+// recorded with.
+func newReplayedResponse(request *http.Request, recorded harResponse) *http.Response {
+	header := http.Header{}
+	for _, h := range recorded.Headers {
+		// the body may have changed size once redacted
+		if !strings.EqualFold(h.Name, "Set-Cookie") && !strings.EqualFold(h.Name, "Content-Length") {
+			header.Add(h.Name, h.Value)
+		}
+	}
+	for _, c := range recorded.Cookies {
+		cookie := &http.Cookie{Name: c.Name, Value: c.Value, Path: c.Path, Domain: c.Domain, HttpOnly: c.HTTPOnly, Secure: c.Secure}
+		if expires, err := time.Parse(time.RFC3339, c.Expires); err == nil {
+			cookie.Expires = expires
+		}
+		header.Add("Set-Cookie", cookie.String())
+	}
+
+	statusText := recorded.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(recorded.Status)
+	}
+	body := recorded.Content.Text
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, statusText),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       request,
+	}
+}
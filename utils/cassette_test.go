@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Morphyni/tas-cli/consts"
+)
+
+// resetCassettes stops replaying and recording
+func resetCassettes() {
+	replayer = nil
+	cassetteRecorder = nil
+	recorder = nil
+}
+
+// send sends the given request through a new HTTP client and returns the response body, the client's cookie jar
+// is returned along with it
+func send(t *testing.T, method, rawURL, body string) (*http.Response, string, http.CookieJar) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := http.NewRequest(method, rawURL, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := NewHTTPClient(jar).Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	bytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, string(bytes), jar
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	defer resetCassettes()
+	dir, err := ioutil.TempDir("", "tas-cli-cassette-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			http.SetCookie(w, &http.Cookie{Name: "idm-session", Value: "cookie-s3cret", Path: "/"})
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"bearer-s3cret","expires_in":3600}`))
+		case "/sandboxes":
+			w.Write([]byte(`{"sandboxes":[{"sandboxName":"MyDefaultSandbox"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	tokenURL := server.URL + "/oauth/token"
+	sandboxesURL := server.URL + "/sandboxes"
+
+	// a scenario of two commands recorded with TASCLI_RECORD, then one recorded with --record-http
+	defer setEnvForTest(consts.TASCLI_RECORD, dir)()
+	for _, rawURL := range []string{tokenURL, sandboxesURL} {
+		if err = ConfigureCassettes(); err != nil {
+			t.Fatal(err)
+		}
+		send(t, "POST", rawURL, "username=jack&password=pw-s3cret")
+		resetCassettes()
+	}
+	os.Setenv(consts.TASCLI_RECORD, "")
+	if err = StartHarRecording(path.Join(dir, "support.har")); err != nil {
+		t.Fatal(err)
+	}
+	send(t, "GET", sandboxesURL+"?page=2", "")
+	resetCassettes()
+	server.Close()
+
+	har, err := readHar(path.Join(dir, CASSETTE_FILENAME))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("Recorded %d entries, expected both commands'", len(har.Log.Entries))
+	}
+
+	// the server is gone, all responses come from the HAR files of the directory
+	defer setEnvForTest(consts.TASCLI_REPLAY, dir)()
+	if err = ConfigureCassettes(); err != nil {
+		t.Fatal(err)
+	}
+	if !IsReplaying() {
+		t.Error("Not replaying with TASCLI_REPLAY set")
+	}
+
+	response, body, jar := send(t, "POST", tokenURL, "username=jack&password=another")
+	if response.StatusCode != http.StatusOK || body != `{"access_token":"***","expires_in":3600}` {
+		t.Errorf("Replayed %d '%s', expected the redacted token response", response.StatusCode, body)
+	}
+	u, _ := url.Parse(server.URL)
+	if cookies := jar.Cookies(u); len(cookies) != 1 || cookies[0].Name != "idm-session" || cookies[0].Value != REDACTED {
+		t.Errorf("Replayed cookies %v, expected the masked idm-session one", cookies)
+	}
+	if _, body, _ = send(t, "POST", sandboxesURL, ""); !strings.Contains(body, "MyDefaultSandbox") {
+		t.Errorf("Replayed '%s', expected the sandboxes", body)
+	}
+	if response, _, _ = send(t, "GET", sandboxesURL+"?page=2", ""); response.StatusCode != http.StatusOK {
+		t.Errorf("Replayed %d from the --record-http file, expected 200", response.StatusCode)
+	}
+
+	request, _ := http.NewRequest("GET", server.URL+"/unknown", nil)
+	if _, err = NewHTTPClient(nil).Do(request); err == nil || !strings.Contains(err.Error(), "No recorded response") {
+		t.Errorf("Unrecorded request gave '%v', expected no recorded response", err)
+	}
+}
+
+// setEnvForTest sets the given environment variable and returns the function restoring it
+func setEnvForTest(name, value string) func() {
+	previous := os.Getenv(name)
+	os.Setenv(name, value)
+	return func() { os.Setenv(name, previous) }
+}
@@ -0,0 +1,348 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+)
+
+// HAR_VERSION is the version of the HAR format written by the recorder
+const HAR_VERSION = "1.2"
+
+// HAR 1.2 format, see http://www.softwareishard.com/blog/har-12-spec/
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"` // custom field, set when no response was received
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harCookie    `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HAR_TRAILER ends the HAR files written by the recorder, the entries being appended right before it
+const HAR_TRAILER = "\n    ]\n  }\n}\n"
+
+// harRecorder appends the recorded entries to the HAR file
+type harRecorder struct {
+	mutex    sync.Mutex
+	filePath string
+	count    int // entries in the file
+}
+
+var recorder *harRecorder
+
+// StartHarRecording records every request made through the shared transport along with its response to the given
+// HAR file, secrets redacted. Every entry is appended as soon as recorded, the file being a complete HAR file
+// whatever the exit path.
+func StartHarRecording(filePath string) error {
+	if filePath == "" {
+		return errors.New("The HAR file name can't be empty.")
+	}
+	r, err := newHarRecorder(filePath, nil)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Can't write HAR file '%s': %s", filePath, err.Error()))
+	}
+	recorder = r
+	return nil
+}
+
+// newHarRecorder creates the recorder of the given HAR file, starting with the given entries. The file is written
+// right away to fail if it can't be rather than after the first request.
+func newHarRecorder(filePath string, entries []harEntry) (*harRecorder, error) {
+	r := &harRecorder{filePath: filePath}
+	creator, err := json.Marshal(harCreator{Name: consts.CLI_MODULE_NAME, Version: consts.CLI_VERSION})
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "{\n  \"log\": {\n    \"version\": \"%s\",\n    \"creator\": %s,\n    \"entries\": [", HAR_VERSION, creator)
+	for _, entry := range entries {
+		data, err := r.encode(entry)
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(data)
+		r.count++
+	}
+	buffer.WriteString(HAR_TRAILER)
+	if err = ioutil.WriteFile(filePath, buffer.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// readHar reads the given HAR file
+func readHar(filePath string) (*harFile, error) {
+	bytes, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	har := &harFile{}
+	if err = json.Unmarshal(bytes, har); err != nil {
+		return nil, err
+	}
+	return har, nil
+}
+
+// encode returns the given entry as an element of the entries array, following the ones already in the file
+func (r *harRecorder) encode(entry harEntry) ([]byte, error) {
+	data, err := json.MarshalIndent(entry, "      ", "  ")
+	if err != nil {
+		return nil, err
+	}
+	separator := ",\n      "
+	if r.count == 0 {
+		separator = "\n      "
+	}
+	return append([]byte(separator), data...), nil
+}
+
+// add appends the given entry to the HAR file, a failure is reported but doesn't fail the request
+func (r *harRecorder) add(entry harEntry) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.append(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Recording to HAR file '%s' failed: %s\n", r.filePath, err.Error())
+	}
+}
+
+// append writes the given entry over the trailer of the HAR file and the trailer after it, so that the cost of
+// recording doesn't grow with the entries already recorded
+func (r *harRecorder) append(entry harEntry) error {
+	data, err := r.encode(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.filePath, os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	offset := info.Size() - int64(len(HAR_TRAILER))
+	trailer := make([]byte, len(HAR_TRAILER))
+	if offset >= 0 {
+		if _, err = f.ReadAt(trailer, offset); err != nil {
+			return err
+		}
+	}
+	if offset < 0 || string(trailer) != HAR_TRAILER {
+		return errors.New("the file was modified since the recording started")
+	}
+	if _, err = f.WriteAt(append(data, HAR_TRAILER...), offset); err != nil {
+		return err
+	}
+	r.count++
+	return nil
+}
+
+// recordingTransport is the http.RoundTripper recording the requests it sends through the wrapped one
+type recordingTransport struct {
+	next     http.RoundTripper
+	recorder *harRecorder
+}
+
+// RoundTrip sends the request and records it along with the response. Both bodies are read in full to be recorded,
+// and replaced so that they can still be read by the caller.
+func (t *recordingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var requestBody []byte
+	if request.Body != nil && request.Body != http.NoBody {
+		var err error
+		if requestBody, err = ioutil.ReadAll(request.Body); err != nil {
+			return nil, err
+		}
+		request.Body.Close()
+		request.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	start := time.Now()
+	response, err := t.next.RoundTrip(request)
+	waited := time.Since(start)
+
+	entry := harEntry{
+		StartedDateTime: start.Format("2006-01-02T15:04:05.000Z07:00"),
+		Request:         newHarRequest(request, requestBody),
+		Response:        harResponse{Cookies: []harCookie{}, Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1},
+	}
+	if err != nil {
+		entry.Error = RedactString(err.Error())
+		entry.Time = toMillis(waited)
+		entry.Timings = harTimings{Wait: entry.Time}
+		t.recorder.add(entry)
+		return nil, err
+	}
+
+	responseBody, readErr := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	received := time.Since(start)
+
+	entry.Response = newHarResponse(response, responseBody)
+	entry.Time = toMillis(received)
+	entry.Timings = harTimings{Wait: toMillis(waited), Receive: toMillis(received - waited)}
+	if readErr != nil {
+		entry.Error = RedactString(readErr.Error())
+	}
+	t.recorder.add(entry)
+	return response, readErr
+}
+
+func newHarRequest(request *http.Request, body []byte) harRequest {
+	harRqst := harRequest{
+		Method:      request.Method,
+		URL:         RedactString(request.URL.String()),
+		HTTPVersion: request.Proto,
+		Cookies:     []harCookie{},
+		Headers:     newHarHeaders(request.Header),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+	for _, cookie := range request.Cookies() {
+		harRqst.Cookies = append(harRqst.Cookies, harCookie{Name: cookie.Name, Value: REDACTED})
+	}
+	for name, values := range request.URL.Query() {
+		for _, value := range values {
+			if isSensitiveKey(name) {
+				value = REDACTED
+			}
+			harRqst.QueryString = append(harRqst.QueryString, harNameValue{Name: name, Value: value})
+		}
+	}
+	if len(body) > 0 {
+		harRqst.PostData = &harPostData{MimeType: request.Header.Get("Content-Type"), Text: RedactString(string(body))}
+	}
+	return harRqst
+}
+
+func newHarResponse(response *http.Response, body []byte) harResponse {
+	harResp := harResponse{
+		Status:      response.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(response.Status, fmt.Sprint(response.StatusCode))),
+		HTTPVersion: response.Proto,
+		Cookies:     []harCookie{},
+		Headers:     newHarHeaders(response.Header),
+		Content: harContent{
+			Size:     len(body),
+			MimeType: response.Header.Get("Content-Type"),
+			Text:     RedactString(string(body)),
+		},
+		RedirectURL: response.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+	for _, cookie := range response.Cookies() {
+		harCookie := harCookie{Name: cookie.Name, Value: REDACTED, Path: cookie.Path, Domain: cookie.Domain,
+			HTTPOnly: cookie.HttpOnly, Secure: cookie.Secure}
+		if !cookie.Expires.IsZero() {
+			harCookie.Expires = cookie.Expires.UTC().Format(time.RFC3339)
+		}
+		harResp.Cookies = append(harResp.Cookies, harCookie)
+	}
+	return harResp
+}
+
+// newHarHeaders converts the given header, the values of the sensitive ones being masked
+func newHarHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			if isSensitiveKey(name) {
+				value = REDACTED
+			}
+			headers = append(headers, harNameValue{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+)
+
+// checkHarFields fails if any of the fields required by HAR 1.2 is missing from the given object
+func checkHarFields(t *testing.T, name string, object interface{}, fields ...string) map[string]interface{} {
+	fieldsOf, ok := object.(map[string]interface{})
+	if !ok {
+		t.Fatalf("%s is %T, expected an object", name, object)
+	}
+	for _, field := range fields {
+		if _, ok := fieldsOf[field]; !ok {
+			t.Errorf("%s lacks '%s': %v", name, field, fieldsOf)
+		}
+	}
+	return fieldsOf
+}
+
+// readHarObject reads the given HAR file as generic JSON, failing if it isn't valid
+func readHarObject(t *testing.T, filePath string) (map[string]interface{}, string) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var har map[string]interface{}
+	if err = json.Unmarshal(content, &har); err != nil {
+		t.Fatalf("HAR file isn't valid JSON: %v\n%s", err, content)
+	}
+	return har, string(content)
+}
+
+func TestHarRecording(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tas-cli-har-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer resetCassettes()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "idm-session", Value: testCookie, Path: "/", HttpOnly: true})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"` + testBearer + `","refresh_token":"` + testRefresh + `"}`))
+	}))
+	defer server.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	filePath := path.Join(dir, "support.har")
+	if err = StartHarRecording(filePath); err != nil {
+		t.Fatal(err)
+	}
+	if har, _ := readHarObject(t, filePath); len(har["log"].(map[string]interface{})["entries"].([]interface{})) != 0 {
+		t.Errorf("Started with entries, expected none")
+	}
+
+	send(t, "POST", server.URL+"/oauth/token", "username=jack&password="+testPassword+"&client_secret="+testClientSecret)
+	_, first := readHarObject(t, filePath)
+
+	request, _ := http.NewRequest("GET", server.URL+"/sandboxes?client_secret="+testClientSecret+"&page=2", nil)
+	request.Header.Set("Authorization", "Bearer "+testBearer)
+	request.AddCookie(&http.Cookie{Name: "idm-session", Value: testCookie})
+	if response, err := NewHTTPClient(nil).Do(request); err == nil {
+		response.Body.Close()
+	} else {
+		t.Fatal(err)
+	}
+	if _, err = NewHTTPClient(nil).Get(closed.URL); err == nil {
+		t.Fatal("Request to a closed server succeeded")
+	}
+
+	har, content := readHarObject(t, filePath)
+	// entries are appended, what was recorded is left as is
+	if !strings.HasPrefix(content, strings.TrimSuffix(first, HAR_TRAILER)) {
+		t.Errorf("Recording rewrote the previous entries:\n%s\nthen:\n%s", first, content)
+	}
+	checkRedacted(t, "HAR file", content)
+
+	log := checkHarFields(t, "log", har["log"], "version", "creator", "entries")
+	if log["version"] != HAR_VERSION {
+		t.Errorf("Version '%v', expected %s", log["version"], HAR_VERSION)
+	}
+	creator := checkHarFields(t, "creator", log["creator"], "name", "version")
+	if creator["name"] != consts.CLI_MODULE_NAME || creator["version"] != consts.CLI_VERSION {
+		t.Errorf("Creator %v, expected %s %s", creator, consts.CLI_MODULE_NAME, consts.CLI_VERSION)
+	}
+	entries, ok := log["entries"].([]interface{})
+	if !ok || len(entries) != 3 {
+		t.Fatalf("Entries %v, expected the 3 requests", log["entries"])
+	}
+	for i, object := range entries {
+		entry := checkHarFields(t, "entry", object, "startedDateTime", "time", "request", "response", "cache", "timings")
+		if _, err = time.Parse(time.RFC3339, entry["startedDateTime"].(string)); err != nil {
+			t.Errorf("Entry %d started at '%v', expected an ISO 8601 date", i, entry["startedDateTime"])
+		}
+		checkHarFields(t, "request", entry["request"], "method", "url", "httpVersion", "cookies", "headers", "queryString",
+			"headersSize", "bodySize")
+		response := checkHarFields(t, "response", entry["response"], "status", "statusText", "httpVersion", "cookies",
+			"headers", "content", "redirectURL", "headersSize", "bodySize")
+		checkHarFields(t, "content", response["content"], "size", "mimeType")
+		checkHarFields(t, "timings", entry["timings"], "send", "wait", "receive")
+	}
+	if failed := entries[2].(map[string]interface{}); failed["_error"] == nil {
+		t.Errorf("Failed request recorded without error: %v", failed)
+	}
+}
+
+func TestHarRecordingModifiedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tas-cli-har-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filePath := path.Join(dir, "support.har")
+	r, err := newHarRecorder(filePath, []harEntry{{Request: harRequest{Method: "GET"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.append(harEntry{Request: harRequest{Method: "POST"}}); err != nil {
+		t.Fatal(err)
+	}
+	har, err := readHar(filePath)
+	if err != nil || len(har.Log.Entries) != 2 || har.Log.Entries[1].Request.Method != "POST" {
+		t.Fatalf("Read %+v, %v, expected both entries", har, err)
+	}
+
+	// the recorder doesn't append within whatever else was written to the file
+	if err = ioutil.WriteFile(filePath, []byte(`{"log":{}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.append(harEntry{}); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("Appending to a modified file gave %v", err)
+	}
+	if content, _ := ioutil.ReadFile(filePath); string(content) != `{"log":{}}` {
+		t.Errorf("Modified file got overwritten with '%s'", content)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// REDACTED replaces the secrets in the logs
+const REDACTED = "***"
+
+// SENSITIVE_KEYS are the names of the form fields, JSON properties, query parameters and log fields holding secrets
+var SENSITIVE_KEYS = []string{
+	"password", "pwd", "passphrase",
+	"access_token", "accessToken", "refresh_token", "refreshToken", "id_token", "idToken", "token",
+	"client_secret", "clientSecret",
+}
+
+// SENSITIVE_HEADERS are the HTTP headers holding secrets
+var SENSITIVE_HEADERS = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+var (
+	sensitiveKeys = "(?:" + strings.Join(SENSITIVE_KEYS, "|") + ")"
+	// password=secret&... as in form-encoded bodies and query strings
+	formSecretRegexp = regexp.MustCompile(`(?i)\b(` + sensitiveKeys + `=)[^&\s"]+`)
+	// "password": "secret" as in JSON bodies
+	jsonSecretRegexp = regexp.MustCompile(`(?i)("` + sensitiveKeys + `"\s*:\s*")(?:[^"\\]|\\.)*"`)
+	// Authorization: Bearer secret as in header dumps
+	headerLineRegexp = regexp.MustCompile(`(?im)^((?:` + strings.Join(SENSITIVE_HEADERS, "|") + `):)[^\r\n]*`)
+	// Authorization:[Bearer secret] as in printed http.Header maps
+	headerMapRegexp = regexp.MustCompile(`(?i)\b((?:` + strings.Join(SENSITIVE_HEADERS, "|") + `):\[)[^\]]*`)
+	// Bearer secret anywhere else
+	bearerRegexp = regexp.MustCompile(`(?i)\b(Bearer\s+)[A-Za-z0-9\-._~+/]+=*`)
+	// Name:session Value:secret as in printed http.Cookie structs
+	cookieStructRegexp = regexp.MustCompile(`(Name:\S* Value:)\S*`)
+)
+
+// RedactString masks the secrets found in the given string, be it form-encoded, JSON, an HTTP dump or a printed struct
+func RedactString(s string) string {
+	s = formSecretRegexp.ReplaceAllString(s, "${1}"+REDACTED)
+	s = jsonSecretRegexp.ReplaceAllString(s, "${1}"+REDACTED+`"`)
+	s = headerLineRegexp.ReplaceAllString(s, "${1} "+REDACTED)
+	s = headerMapRegexp.ReplaceAllString(s, "${1}"+REDACTED)
+	s = bearerRegexp.ReplaceAllString(s, "${1}"+REDACTED)
+	s = cookieStructRegexp.ReplaceAllString(s, "${1}"+REDACTED)
+	return s
+}
+
+// isSensitiveKey tells whether the given field name holds a secret
+func isSensitiveKey(key string) bool {
+	for _, sensitiveKey := range SENSITIVE_KEYS {
+		if strings.EqualFold(key, sensitiveKey) {
+			return true
+		}
+	}
+	for _, header := range SENSITIVE_HEADERS {
+		if strings.EqualFold(key, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactionHook is a logrus hook masking the secrets of every log entry, see RedactString
+type RedactionHook struct{}
+
+// InstallRedactionHook adds the RedactionHook to the standard logger, so that no secret gets logged whatever the level
+func InstallRedactionHook() {
+	log.AddHook(&RedactionHook{})
+}
+
+// Levels returns all levels, secrets must not be logged at any level
+func (h *RedactionHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire masks the secrets of the message and fields of the entry before it gets formatted
+func (h *RedactionHook) Fire(entry *log.Entry) error {
+	entry.Message = RedactString(entry.Message)
+	for key, value := range entry.Data {
+		if isSensitiveKey(key) {
+			entry.Data[key] = REDACTED
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = RedactString(v)
+		case error:
+			entry.Data[key] = RedactString(v.Error())
+		case fmt.Stringer:
+			entry.Data[key] = RedactString(v.String())
+		}
+	}
+	return nil
+}
+
+// DumpRequest returns a loggable dump of the given request along with its body, secrets masked
+func DumpRequest(request *http.Request, body []byte) string {
+	var dump strings.Builder
+	fmt.Fprintf(&dump, "%s %s %s\n", request.Method, request.URL.String(), request.Proto)
+	dumpHeader(&dump, request.Header)
+	dumpBody(&dump, body)
+	return RedactString(dump.String())
+}
+
+// DumpResponse returns a loggable dump of the given response along with its body, secrets masked
+func DumpResponse(response *http.Response, body []byte) string {
+	var dump strings.Builder
+	fmt.Fprintf(&dump, "%s %s\n", response.Proto, response.Status)
+	dumpHeader(&dump, response.Header)
+	dumpBody(&dump, body)
+	return RedactString(dump.String())
+}
+
+// dumpHeader writes the header sorted by name, the values of the sensitive ones masked
+func dumpHeader(dump *strings.Builder, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			if isSensitiveKey(name) {
+				value = REDACTED
+			}
+			fmt.Fprintf(dump, "%s: %s\n", name, value)
+		}
+	}
+}
+
+func dumpBody(dump *strings.Builder, body []byte) {
+	if len(body) > 0 {
+		fmt.Fprintf(dump, "\n%s\n", body)
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	testPassword     = "pw-s3cret"
+	testBearer       = "bearer-s3cret"
+	testCookie       = "cookie-s3cret"
+	testClientSecret = "client-s3cret"
+	testRefresh      = "refresh-s3cret"
+)
+
+var testSecrets = []string{testPassword, testBearer, testCookie, testClientSecret, testRefresh}
+
+// captureLogs sends the debug logs of the standard logger, with the redaction hook installed, to the returned buffer
+// until the returned function is called
+func captureLogs(formatter log.Formatter) (*bytes.Buffer, func()) {
+	logger := log.StandardLogger()
+	previousOut, previousLevel, previousFormatter := logger.Out, logger.GetLevel(), logger.Formatter
+	previousHooks := logger.ReplaceHooks(log.LevelHooks{})
+	var buffer bytes.Buffer
+	log.SetOutput(&buffer)
+	log.SetLevel(log.DebugLevel)
+	log.SetFormatter(formatter)
+	InstallRedactionHook()
+	return &buffer, func() {
+		log.SetOutput(previousOut)
+		log.SetLevel(previousLevel)
+		log.SetFormatter(previousFormatter)
+		logger.ReplaceHooks(previousHooks)
+	}
+}
+
+// checkRedacted fails if any of the test secrets is in the given output, or if nothing was masked
+func checkRedacted(t *testing.T, name, output string) {
+	for _, secret := range testSecrets {
+		if strings.Contains(output, secret) {
+			t.Errorf("%s: secret '%s' leaked in:\n%s", name, secret, output)
+		}
+	}
+	if !strings.Contains(output, REDACTED) {
+		t.Errorf("%s: nothing masked in:\n%s", name, output)
+	}
+}
+
+func TestRedactionHook(t *testing.T) {
+	for name, formatter := range map[string]log.Formatter{"text": &log.TextFormatter{}, "json": &log.JSONFormatter{}} {
+		buffer, restore := captureLogs(formatter)
+
+		log.Debugf("About to post username=jack&password=%s&client_id=cli&client_secret=%s", testPassword, testClientSecret)
+		log.Debugf(`Response {"access_token":"%s","refresh_token":"%s","expires_in":3600}`, testBearer, testRefresh)
+		log.Debugf(`Login request {"username":"jack","password":"%s"}`, testPassword)
+		log.Debugf("Request header: %v", http.Header{"Authorization": {"Bearer " + testBearer}, "Cookie": {"idm=" + testCookie}})
+		log.Debugf("Calling with Bearer %s", testBearer)
+		log.Debugf("Cookie %+v", http.Cookie{Name: "idm", Value: testCookie, Path: "/"})
+		log.Debugf("Query %s", url.Values{"refresh_token": {testRefresh}, "client_secret": {testClientSecret}}.Encode())
+		log.WithField("password", testPassword).WithField("Authorization", "Bearer "+testBearer).Debug("Fields")
+		log.WithField("request", "client_secret="+testClientSecret).Debug("String field")
+		log.WithError(errors.New("rejected token=" + testRefresh)).Debug("Error field")
+		log.Infof("Retrying with password=%s", testPassword)
+		restore()
+
+		output := buffer.String()
+		checkRedacted(t, name, output)
+		for _, kept := range []string{"username=jack", "client_id=cli", "expires_in", "Path:/"} {
+			if !strings.Contains(output, kept) {
+				t.Errorf("%s: '%s' got masked too:\n%s", name, kept, output)
+			}
+		}
+	}
+}
+
+func TestDumpRequest(t *testing.T) {
+	request, err := http.NewRequest("POST", "https://accounts.example.com/oauth/token?client_secret="+testClientSecret, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+testBearer)
+	request.Header.Set("Cookie", "idm="+testCookie)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	body := "grant_type=password&username=jack&password=" + testPassword
+
+	dump := DumpRequest(request, []byte(body))
+	checkRedacted(t, "request", dump)
+	for _, kept := range []string{"POST https://accounts.example.com/oauth/token", "Content-Type: application/x-www-form-urlencoded",
+		"grant_type=password&username=jack"} {
+		if !strings.Contains(dump, kept) {
+			t.Errorf("'%s' missing from the request dump:\n%s", kept, dump)
+		}
+	}
+}
+
+func TestDumpResponse(t *testing.T) {
+	response := &http.Response{
+		Proto:  "HTTP/1.1",
+		Status: "200 OK",
+		Header: http.Header{
+			"Set-Cookie":   {"idm=" + testCookie + "; Path=/; HttpOnly"},
+			"Content-Type": {"application/json"},
+		},
+	}
+	body := fmt.Sprintf(`{"access_token":"%s","refresh_token":"%s","token_type":"bearer"}`, testBearer, testRefresh)
+
+	dump := DumpResponse(response, []byte(body))
+	checkRedacted(t, "response", dump)
+	for _, kept := range []string{"HTTP/1.1 200 OK", "Content-Type: application/json", `"token_type":"bearer"`} {
+		if !strings.Contains(dump, kept) {
+			t.Errorf("'%s' missing from the response dump:\n%s", kept, dump)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	"github.com/Morphyni/tas-cli/consts"
+	"github.com/Morphyni/tas-cli/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// HTTP_CONNECTION_ERROR_CODE is the HTTP code of the responses for which the server couldn't be reached at all
+const HTTP_CONNECTION_ERROR_CODE = 599
+
+// RestHandler executes the REST calls against the TIBCO Cloud servers
+type RestHandler struct {
+	userId       string
+	retryAttempt *types.RetryAttempt
+}
+
+// NewRestHandler creates a new RestHandler, retrying the calls as told by retryAttempt, see DoWithRetry
+func NewRestHandler(userId string, retryAttempt *types.RetryAttempt) *RestHandler {
+	return &RestHandler{userId: userId, retryAttempt: retryAttempt}
+}
+
+// Execute sends the given request with the cookies of the given jar, if any. Failures, be it to connect or
+// an unsuccessful HTTP status, are reported through the ErrorResponse of the response.
+func (h *RestHandler) Execute(restCallRequest *types.RestCallRequest, cookieJar http.CookieJar) *types.RestCallResponse {
+	start := time.Now()
+	response := &types.RestCallResponse{}
+
+	// the body is buffered so that it can be sent again on retries
+	var body []byte
+	if restCallRequest.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(restCallRequest.Body); err != nil {
+			return connectionErrorResponse(response, err)
+		}
+	}
+
+	httpClient := NewHTTPClient(cookieJar)
+
+	newRequest := func() (*http.Request, error) {
+		request, err := http.NewRequest(restCallRequest.Method, restCallRequest.Url.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range restCallRequest.Headers {
+			request.Header.Set(name, value)
+		}
+		if restCallRequest.LogRequest || IsDevMode() {
+			log.Debugf("[%s] %s", h.userId, DumpRequest(request, body))
+		}
+		return request, nil
+	}
+
+	resp, attempts, err := DoWithRetry(restCallRequest.Context, httpClient, newRequest, h.retryAttempt)
+	response.Attempts = attempts
+	if err != nil {
+		response.Duration = time.Since(start)
+		return connectionErrorResponse(response, CheckTimeout(restCallRequest.Context, err, serviceName(restCallRequest)))
+	}
+	defer resp.Body.Close()
+
+	response.HttpCode = resp.StatusCode
+	response.Status = resp.Status
+	response.Headers = resp.Header
+	response.Cookies = resp.Cookies()
+	responseBytes, err := ioutil.ReadAll(resp.Body)
+	response.Duration = time.Since(start)
+	if err != nil {
+		return connectionErrorResponse(response, CheckTimeout(restCallRequest.Context, err, serviceName(restCallRequest)))
+	}
+	response.ResponseBytes = responseBytes
+	if restCallRequest.LogRequest || IsDevMode() {
+		log.Debugf("[%s] %s", h.userId, DumpResponse(resp, responseBytes))
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		response.ErrorResponse = decodeErrorResponse(resp, responseBytes)
+	}
+	return response
+}
+
+// serviceName returns the name of the service called by the given request to use in errors
+func serviceName(restCallRequest *types.RestCallRequest) string {
+	if restCallRequest.Service != "" {
+		return restCallRequest.Service
+	}
+	return restCallRequest.Url.Host
+}
+
+// connectionErrorResponse fills the given response for a call that didn't get any response from the server
+func connectionErrorResponse(response *types.RestCallResponse, err error) *types.RestCallResponse {
+	response.HttpCode = HTTP_CONNECTION_ERROR_CODE
+	response.ErrorResponse = &types.ErrorResponse{
+		ErrorCode: strconv.Itoa(HTTP_CONNECTION_ERROR_CODE),
+		ErrorMsg:  err.Error(),
+	}
+	return response
+}
+
+// decodeErrorResponse decodes the error the servers send along with an unsuccessful status,
+// falling back to the status and the raw body if it's not the usual error JSON
+func decodeErrorResponse(resp *http.Response, responseBytes []byte) *types.ErrorResponse {
+	errorResponse := &types.ErrorResponse{}
+	if err := json.Unmarshal(responseBytes, errorResponse); err == nil && errorResponse.ErrorMsg != "" {
+		if errorResponse.ErrorCode == "" {
+			errorResponse.ErrorCode = strconv.Itoa(resp.StatusCode)
+		}
+		return errorResponse
+	}
+	return &types.ErrorResponse{
+		ErrorCode:   strconv.Itoa(resp.StatusCode),
+		ErrorMsg:    resp.Status,
+		ErrorDetail: string(responseBytes),
+	}
+}
+
+// GetCookieJar creates a cookie jar holding the cookies of the local session for the given URL
+func GetCookieJar(u *url.URL) (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	session, err := LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	if len(session.Cookies) > 0 {
+		jar.SetCookies(u, session.Cookies)
+	}
+	return jar, nil
+}
+
+// RefreshCookies persists the cookies set by a response into the local session file
+func RefreshCookies(cookies []*http.Cookie) error {
+	if len(cookies) == 0 {
+		return nil
+	}
+	session, err := LoadSession(consts.OBFUSCATE_COOKIE_VALUE)
+	if err != nil {
+		return err
+	}
+	return session.UpdateCookies(cookies, consts.OBFUSCATE_COOKIE_VALUE)
+}
+
+// IsDevMode tells whether extra debug info, sensitive data included, was asked for through TASCLI_DBG
+func IsDevMode() bool {
+	return os.Getenv(consts.TASCLI_DBG) != ""
+}
+
+// PrintStackTrace logs the given message along with the current stack trace, skipping the given number of frames
+func PrintStackTrace(skip int, msg string) {
+	log.Debugf("%s\n%s", msg, bytes.Join(bytes.Split(debug.Stack(), []byte("\n"))[1+2*skip:], []byte("\n")))
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package utils
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Morphyni/tas-cli/types"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DEFAULT_RETRIES        = 3
+	DEFAULT_RETRY_INTERVAL = 500 * time.Millisecond
+	DEFAULT_RETRY_MAX_WAIT = 30 * time.Second
+	DEFAULT_RETRY_JITTER   = 0.2
+)
+
+// retryPolicy is the policy used by all web clients, see SetRetryPolicy
+var retryPolicy = types.RetryAttempt{
+	Count:    DEFAULT_RETRIES,
+	Interval: DEFAULT_RETRY_INTERVAL,
+	MaxWait:  DEFAULT_RETRY_MAX_WAIT,
+	Jitter:   DEFAULT_RETRY_JITTER,
+}
+
+// SetRetryPolicy overrides the number of retries and the longest single wait of all web clients,
+// e.g. with the --retries and --retry-max-wait flags
+func SetRetryPolicy(retries int, maxWait time.Duration) {
+	if retries < 0 {
+		retries = 0
+	}
+	retryPolicy.Count = retries
+	retryPolicy.MaxWait = maxWait
+}
+
+// GetRetryAttempt returns a copy of the retry policy shared by all web clients
+func GetRetryAttempt() *types.RetryAttempt {
+	retryAttempt := retryPolicy
+	return &retryAttempt
+}
+
+// DoWithRetry sends the request built by newRequest with the given client as many times as told by retryAttempt,
+// a new request being built for every attempt. A single attempt is made if retryAttempt is nil.
+// Cancelling ctx aborts the pending attempt as well as the wait for the next one.
+// It returns the last response or error along with the number of attempts made.
+func DoWithRetry(ctx context.Context, httpClient *http.Client, newRequest func() (*http.Request, error),
+	retryAttempt *types.RetryAttempt) (*http.Response, int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for attempt := 1; ; attempt++ {
+		request, err := newRequest()
+		if err != nil {
+			return nil, attempt, err
+		}
+		response, err := httpClient.Do(request.WithContext(ctx))
+		if ctx.Err() != nil {
+			// whatever happened, the caller isn't interested anymore
+			if response != nil {
+				response.Body.Close()
+			}
+			return nil, attempt, ctx.Err()
+		}
+
+		if retryAttempt == nil || attempt > retryAttempt.Count || !shouldRetry(request, response, err, retryAttempt) {
+			return response, attempt, err
+		}
+
+		wait, ok := retryDelay(attempt, response, retryAttempt)
+		if !ok {
+			log.Debugf("%s %s: the server asks to retry later than %v, giving up", request.Method, request.URL.String(), retryAttempt.MaxWait)
+			return response, attempt, err
+		}
+		if err != nil {
+			log.Debugf("%s %s failed: %s; retrying in %v", request.Method, request.URL.String(), err.Error(), wait)
+		} else {
+			log.Debugf("%s %s returned %s; retrying in %v", request.Method, request.URL.String(), response.Status, wait)
+			response.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, attempt, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// shouldRetry tells whether the outcome of the request is worth another attempt. Requests with a non-idempotent
+// method are only retried when it's certain the server didn't process them, unless the policy says otherwise.
+func shouldRetry(request *http.Request, response *http.Response, err error, retryAttempt *types.RetryAttempt) bool {
+	retryAny := retryAttempt.RetryNonIdempotent || isIdempotent(request.Method)
+	if err != nil {
+		return retryAny || isDialError(err)
+	}
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return retryAny
+	}
+	return false
+}
+
+// isIdempotent tells whether sending a request with the given method several times has the same effect as once
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// isDialError tells whether the error happened while connecting, i.e. before anything was sent to the server
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// retryDelay returns how long to wait before the next attempt: the Retry-After of the response if any, else an
+// exponential backoff with jitter. The second return value is false if the server asks to wait longer than allowed.
+func retryDelay(attempt int, response *http.Response, retryAttempt *types.RetryAttempt) (time.Duration, bool) {
+	if response != nil {
+		if wait, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			if retryAttempt.MaxWait > 0 && wait > retryAttempt.MaxWait {
+				return 0, false
+			}
+			return wait, true
+		}
+	}
+
+	wait := float64(retryAttempt.Interval) * math.Pow(2, float64(attempt-1))
+	if retryAttempt.Jitter > 0 {
+		wait += wait * retryAttempt.Jitter * (2*rand.Float64() - 1)
+	}
+	if retryAttempt.MaxWait > 0 && wait > float64(retryAttempt.MaxWait) {
+		wait = float64(retryAttempt.MaxWait)
+	}
+	return time.Duration(wait), true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number of seconds or an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morphyni/tas-cli/types"
+)
+
+func TestDoWithRetry(t *testing.T) {
+	fast := &types.RetryAttempt{Count: 2, Interval: 10 * time.Millisecond}
+	tests := []struct {
+		name       string
+		method     string
+		statuses   []int         // status of each attempt, the last one is repeated
+		retryAfter func() string // Retry-After of the unsuccessful responses
+		hangUp     bool          // the server closes the connection without responding
+		closed     bool          // nothing listens
+		policy     *types.RetryAttempt
+		attempts   int
+		minElapsed time.Duration
+		maxElapsed time.Duration
+	}{
+		{name: "no policy", method: http.MethodGet, statuses: []int{503}, attempts: 1},
+		{name: "success", method: http.MethodGet, statuses: []int{200}, policy: fast, attempts: 1},
+		{name: "503 until success", method: http.MethodGet, statuses: []int{503, 503, 200}, policy: fast, attempts: 3,
+			minElapsed: 30 * time.Millisecond},
+		{name: "503 gives up after count", method: http.MethodGet, statuses: []int{503}, policy: fast, attempts: 3},
+		{name: "429 of a POST", method: http.MethodPost, statuses: []int{429, 200}, policy: fast, attempts: 2},
+		{name: "500 not retried", method: http.MethodGet, statuses: []int{500}, policy: fast, attempts: 1},
+		{name: "502 of a GET", method: http.MethodGet, statuses: []int{502, 200}, policy: fast, attempts: 2},
+		{name: "504 of a PUT", method: http.MethodPut, statuses: []int{504, 200}, policy: fast, attempts: 2},
+		{name: "502 of a POST", method: http.MethodPost, statuses: []int{502}, policy: fast, attempts: 1},
+		{name: "504 of a POST", method: http.MethodPost, statuses: []int{504}, policy: fast, attempts: 1},
+		{name: "502 of a POST when allowed", method: http.MethodPost, statuses: []int{502},
+			policy: &types.RetryAttempt{Count: 2, Interval: 10 * time.Millisecond, RetryNonIdempotent: true}, attempts: 3},
+		{name: "dial error of a POST", method: http.MethodPost, closed: true, policy: fast, attempts: 3},
+		{name: "dial error of a GET", method: http.MethodGet, closed: true, policy: fast, attempts: 3},
+		{name: "hang up of a POST", method: http.MethodPost, hangUp: true, policy: fast, attempts: 1},
+		{name: "hang up of a GET", method: http.MethodGet, hangUp: true, policy: fast, attempts: 3},
+		{name: "Retry-After in seconds", method: http.MethodGet, statuses: []int{503, 200},
+			retryAfter: func() string { return "1" }, policy: fast, attempts: 2, minElapsed: time.Second},
+		{name: "Retry-After as a date", method: http.MethodGet, statuses: []int{503, 200},
+			retryAfter: func() string { return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat) },
+			policy:     fast, attempts: 2, minElapsed: time.Second, maxElapsed: 3 * time.Second},
+		{name: "Retry-After over MaxWait", method: http.MethodGet, statuses: []int{503},
+			retryAfter: func() string { return "5" },
+			policy:     &types.RetryAttempt{Count: 2, Interval: 10 * time.Millisecond, MaxWait: 500 * time.Millisecond},
+			attempts:   1, maxElapsed: 500 * time.Millisecond},
+		{name: "backoff capped by MaxWait", method: http.MethodGet, statuses: []int{503, 503, 200},
+			policy:   &types.RetryAttempt{Count: 2, Interval: time.Second, MaxWait: 20 * time.Millisecond},
+			attempts: 3, minElapsed: 40 * time.Millisecond, maxElapsed: 900 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		var lock sync.Mutex
+		received := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			received++
+			attempt := received
+			lock.Unlock()
+			if test.hangUp {
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err == nil {
+					conn.Close()
+				}
+				return
+			}
+			status := test.statuses[len(test.statuses)-1]
+			if attempt <= len(test.statuses) {
+				status = test.statuses[attempt-1]
+			}
+			if status != http.StatusOK && test.retryAfter != nil {
+				w.Header().Set("Retry-After", test.retryAfter())
+			}
+			w.WriteHeader(status)
+		}))
+		if test.closed {
+			server.Close()
+		}
+		// a new transport each time, not to reuse connections of previous tests
+		httpClient := &http.Client{Transport: &http.Transport{}}
+		newRequest := func() (*http.Request, error) {
+			return http.NewRequest(test.method, server.URL, strings.NewReader("body"))
+		}
+
+		start := time.Now()
+		response, attempts, err := DoWithRetry(context.Background(), httpClient, newRequest, test.policy)
+		elapsed := time.Since(start)
+		if response != nil {
+			response.Body.Close()
+		}
+		server.Close()
+
+		if attempts != test.attempts {
+			t.Errorf("%s: %d attempts, expected %d", test.name, attempts, test.attempts)
+		}
+		if !test.closed && received != attempts {
+			t.Errorf("%s: server got %d requests for %d attempts", test.name, received, attempts)
+		}
+		if (test.closed || test.hangUp) && err == nil {
+			t.Errorf("%s: no error returned", test.name)
+		}
+		if elapsed < test.minElapsed {
+			t.Errorf("%s: took %v, expected at least %v", test.name, elapsed, test.minElapsed)
+		}
+		maxElapsed := test.maxElapsed
+		if maxElapsed == 0 {
+			maxElapsed = test.minElapsed + time.Second
+		}
+		if elapsed > maxElapsed {
+			t.Errorf("%s: took %v, expected at most %v", test.name, elapsed, maxElapsed)
+		}
+	}
+}
+
+func TestDoWithRetryCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	newRequest := func() (*http.Request, error) { return http.NewRequest(http.MethodGet, server.URL, nil) }
+	start := time.Now()
+	_, attempts, err := DoWithRetry(ctx, &http.Client{}, newRequest, &types.RetryAttempt{Count: 5, Interval: time.Second})
+	if err != context.DeadlineExceeded || attempts != 1 || time.Since(start) > time.Second {
+		t.Errorf("Got %v after %d attempts in %v, expected the wait for the next attempt to be cancelled", err, attempts, time.Since(start))
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	policy := &types.RetryAttempt{Interval: 100 * time.Millisecond, Jitter: 0.2}
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 80 * time.Millisecond, 120 * time.Millisecond},
+		{2, 160 * time.Millisecond, 240 * time.Millisecond},
+		{3, 320 * time.Millisecond, 480 * time.Millisecond},
+	}
+	for _, test := range tests {
+		seen := map[time.Duration]bool{}
+		for i := 0; i < 1000; i++ {
+			wait, ok := retryDelay(test.attempt, nil, policy)
+			if !ok || wait < test.min || wait > test.max {
+				t.Fatalf("Attempt %d: waiting %v, %t, expected between %v and %v", test.attempt, wait, ok, test.min, test.max)
+			}
+			seen[wait] = true
+		}
+		if len(seen) < 100 {
+			t.Errorf("Attempt %d: only %d different waits, expected them to be spread", test.attempt, len(seen))
+		}
+	}
+
+	// without jitter the backoff is exact, and capped by MaxWait
+	policy = &types.RetryAttempt{Interval: 100 * time.Millisecond, MaxWait: 300 * time.Millisecond}
+	for attempt, expected := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 4: 300 * time.Millisecond} {
+		if wait, ok := retryDelay(attempt, nil, policy); !ok || wait != expected {
+			t.Errorf("Attempt %d: waiting %v, %t, expected %v", attempt, wait, ok, expected)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value    string
+		ok       bool
+		min, max time.Duration
+	}{
+		{value: "", ok: false},
+		{value: "soon", ok: false},
+		{value: "-1", ok: false},
+		{value: "0", ok: true},
+		{value: "120", ok: true, min: 2 * time.Minute, max: 2 * time.Minute},
+		{value: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), ok: true},
+		{value: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), ok: true, min: 59 * time.Minute, max: time.Hour},
+	}
+	for _, test := range tests {
+		wait, ok := parseRetryAfter(test.value)
+		if ok != test.ok || wait < test.min || wait > test.max {
+			t.Errorf("'%s': got %v, %t, expected %t between %v and %v", test.value, wait, ok, test.ok, test.min, test.max)
+		}
+	}
+}
+
+// the body of a retried request is sent again as is
+func TestRetryReplaysBody(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		bodies = append(bodies, string(body))
+		attempt := len(bodies)
+		lock.Unlock()
+		if attempt < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewRestHandler("", &types.RetryAttempt{Count: 3, Interval: 10 * time.Millisecond})
+	response := handler.Execute(&types.RestCallRequest{
+		Context: context.Background(),
+		Url:     serverURL,
+		Method:  http.MethodPost,
+		Body:    strings.NewReader(`{"name":"sandbox"}`),
+	}, nil)
+
+	if response.HttpCode != http.StatusOK || response.Attempts != 3 {
+		t.Errorf("Got %d after %d attempts, expected success on the third one", response.HttpCode, response.Attempts)
+	}
+	expected := []string{`{"name":"sandbox"}`, `{"name":"sandbox"}`, `{"name":"sandbox"}`}
+	if !reflect.DeepEqual(bodies, expected) {
+		t.Errorf("Server got %q, expected the body on every attempt", bodies)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+const (
+	// INTERRUPTED_EXIT_CODE is the exit code when interrupted by SIGINT/SIGTERM, as shells do (128 + SIGINT)
+	INTERRUPTED_EXIT_CODE = 130
+	// SHUTDOWN_TIMEOUT bounds the time taken by all shutdown handlers, exiting anyway once elapsed
+	SHUTDOWN_TIMEOUT = 5 * time.Second
+	// CONTEXT_METADATA_KEY is the key of the command context in the metadata of the cli app
+	CONTEXT_METADATA_KEY = "context"
+)
+
+type shutdownHandler struct {
+	id      int
+	name    string
+	handler func()
+}
+
+var (
+	shutdownMutex         sync.Mutex
+	shutdownHandlers      []shutdownHandler
+	nextShutdownHandlerId int
+	shutdownOnce          sync.Once
+	// shutdownTimeout is SHUTDOWN_TIMEOUT, shortened by tests
+	shutdownTimeout = SHUTDOWN_TIMEOUT
+	// exit ends the process, replaced by tests
+	exit = os.Exit
+	// notifySignals relays the signals interrupting the CLI to the given channel, replaced by tests
+	notifySignals = func(c chan<- os.Signal) {
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	}
+)
+
+// RegisterShutdownHandler registers a handler run when the CLI is interrupted, e.g. to delete a server-side query
+// or flush cookies. It returns the id to pass to UnregisterShutdownHandler once the handler isn't needed anymore.
+func RegisterShutdownHandler(name string, handler func()) int {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	nextShutdownHandlerId++
+	shutdownHandlers = append(shutdownHandlers, shutdownHandler{id: nextShutdownHandlerId, name: name, handler: handler})
+	return nextShutdownHandlerId
+}
+
+// UnregisterShutdownHandler removes the handler with the given id, it's a no-op if there's no such handler
+func UnregisterShutdownHandler(id int) {
+	shutdownMutex.Lock()
+	defer shutdownMutex.Unlock()
+	for i, handler := range shutdownHandlers {
+		if handler.id == id {
+			shutdownHandlers = append(shutdownHandlers[:i], shutdownHandlers[i+1:]...)
+			return
+		}
+	}
+}
+
+// ExecAllShutdownHandlers runs the registered handlers once, the most recently registered first.
+// It gives up waiting for them after SHUTDOWN_TIMEOUT.
+func ExecAllShutdownHandlers() {
+	shutdownOnce.Do(func() {
+		shutdownMutex.Lock()
+		handlers := make([]shutdownHandler, len(shutdownHandlers))
+		copy(handlers, shutdownHandlers)
+		shutdownMutex.Unlock()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := len(handlers) - 1; i >= 0; i-- {
+				execShutdownHandler(handlers[i])
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(shutdownTimeout):
+			log.Debugf("Shutdown handlers didn't complete within %v, exiting anyway", shutdownTimeout)
+		}
+	})
+}
+
+// execShutdownHandler runs the given handler, a failing handler mustn't prevent the others from running
+func execShutdownHandler(handler shutdownHandler) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Debugf("Shutdown handler '%s' failed: %v", handler.name, r)
+		}
+	}()
+	log.Debugf("Running shutdown handler '%s'", handler.name)
+	handler.handler()
+}
+
+// ExitInterrupted runs the shutdown handlers then exits with INTERRUPTED_EXIT_CODE
+func ExitInterrupted() {
+	ExecAllShutdownHandlers()
+	exit(INTERRUPTED_EXIT_CODE)
+}
+
+// HandleSignals waits in the background for SIGINT/SIGTERM. On signal, it cancels the command context so that
+// pending requests get aborted, calls onSignal if not nil (e.g. to restore the terminal), then exits through
+// ExitInterrupted.
+func HandleSignals(cancel context.CancelFunc, onSignal func()) {
+	c := make(chan os.Signal, 1)
+	notifySignals(c)
+	go func() {
+		<-c
+		if onSignal != nil {
+			onSignal()
+		}
+		log.Debug("System interrupt signal received, exit.")
+		cancel()
+		ExitInterrupted()
+	}()
+}
+
+// IsInterrupted tells whether the error is due to the command context being cancelled
+func IsInterrupted(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// SetCommandContext makes the given context available to all commands of the app, see CommandContext
+func SetCommandContext(app *cli.App, ctx context.Context) {
+	if app.Metadata == nil {
+		app.Metadata = map[string]interface{}{}
+	}
+	app.Metadata[CONTEXT_METADATA_KEY] = ctx
+}
+
+// CommandContext returns the context of the running command, cancelled when the CLI is interrupted.
+// It's to be passed to every client so that pending requests get aborted.
+func CommandContext(c *cli.Context) context.Context {
+	if c != nil && c.App != nil {
+		if ctx, ok := c.App.Metadata[CONTEXT_METADATA_KEY].(context.Context); ok {
+			return ctx
+		}
+	}
+	return context.Background()
+}
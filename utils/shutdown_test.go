@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Morphyni/tas-cli/types"
+)
+
+// shutdownEvents records what happens on shutdown, in order
+type shutdownEvents struct {
+	lock   sync.Mutex
+	events []string
+	exited chan int
+}
+
+func (se *shutdownEvents) add(event string) {
+	se.lock.Lock()
+	defer se.lock.Unlock()
+	se.events = append(se.events, event)
+}
+
+func (se *shutdownEvents) get() []string {
+	se.lock.Lock()
+	defer se.lock.Unlock()
+	return append([]string{}, se.events...)
+}
+
+// fakeShutdown forgets the registered handlers and whether they ran, records the exit instead of exiting and relays
+// the signals sent to the returned channel. The returned function restores everything.
+func fakeShutdown(timeout time.Duration) (*shutdownEvents, chan os.Signal, func()) {
+	events := &shutdownEvents{exited: make(chan int, 1)}
+	signals := make(chan os.Signal, 1)
+	previousExit, previousNotify, previousTimeout := exit, notifySignals, shutdownTimeout
+
+	shutdownMutex.Lock()
+	shutdownHandlers = nil
+	shutdownMutex.Unlock()
+	shutdownOnce = sync.Once{}
+	shutdownTimeout = timeout
+	exit = func(code int) {
+		events.add("exit")
+		events.exited <- code
+	}
+	notifySignals = func(c chan<- os.Signal) {
+		go func() {
+			for signal := range signals {
+				c <- signal
+			}
+		}()
+	}
+	return events, signals, func() {
+		close(signals)
+		exit, notifySignals, shutdownTimeout = previousExit, previousNotify, previousTimeout
+		shutdownMutex.Lock()
+		shutdownHandlers = nil
+		shutdownMutex.Unlock()
+		shutdownOnce = sync.Once{}
+	}
+}
+
+func TestShutdownHandlersRunOnce(t *testing.T) {
+	events, _, restore := fakeShutdown(time.Second)
+	defer restore()
+
+	RegisterShutdownHandler("first", func() { events.add("first") })
+	unregistered := RegisterShutdownHandler("unregistered", func() { events.add("unregistered") })
+	RegisterShutdownHandler("failing", func() {
+		events.add("failing")
+		panic("handler failure")
+	})
+	RegisterShutdownHandler("last", func() { events.add("last") })
+	UnregisterShutdownHandler(unregistered)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ExecAllShutdownHandlers()
+		}()
+	}
+	wg.Wait()
+	ExecAllShutdownHandlers()
+
+	// the most recently registered first, a failing one not preventing the others from running
+	if expected := []string{"last", "failing", "first"}; !reflect.DeepEqual(events.get(), expected) {
+		t.Errorf("Ran %v, expected %v once", events.get(), expected)
+	}
+}
+
+func TestShutdownHandlersTimeout(t *testing.T) {
+	events, _, restore := fakeShutdown(100 * time.Millisecond)
+	defer restore()
+
+	release := make(chan struct{})
+	defer close(release)
+	RegisterShutdownHandler("quick", func() { events.add("quick") })
+	RegisterShutdownHandler("stuck", func() { <-release })
+
+	start := time.Now()
+	ExitInterrupted()
+	elapsed := time.Since(start)
+
+	if elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Exited after %v, expected to give up on the handlers after 100ms", elapsed)
+	}
+	if code := <-events.exited; code != INTERRUPTED_EXIT_CODE {
+		t.Errorf("Exited with %d, expected %d", code, INTERRUPTED_EXIT_CODE)
+	}
+	// the handlers run one after the other, the one after the stuck handler didn't get to run
+	if expected := []string{"exit"}; !reflect.DeepEqual(events.get(), expected) {
+		t.Errorf("Got %v, expected %v", events.get(), expected)
+	}
+}
+
+func TestSignalCancelsRequestAndExits(t *testing.T) {
+	events, signals, restore := fakeShutdown(time.Second)
+	defer restore()
+
+	received := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	HandleSignals(cancel, func() { events.add("signal") })
+	RegisterShutdownHandler("cleanup", func() { events.add("cleanup") })
+
+	responses := make(chan *types.RestCallResponse, 1)
+	go func() {
+		handler := NewRestHandler("", &types.RetryAttempt{Count: 3, Interval: time.Second})
+		responses <- handler.Execute(&types.RestCallRequest{Context: ctx, Url: serverURL, Method: http.MethodGet}, nil)
+	}()
+	<-received
+	signals <- os.Interrupt
+
+	select {
+	case code := <-events.exited:
+		if code != INTERRUPTED_EXIT_CODE {
+			t.Errorf("Exited with %d, expected %d", code, INTERRUPTED_EXIT_CODE)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Didn't exit on signal")
+	}
+	if expected := []string{"signal", "cleanup", "exit"}; !reflect.DeepEqual(events.get(), expected) {
+		t.Errorf("Got %v, expected %v", events.get(), expected)
+	}
+
+	select {
+	case response := <-responses:
+		if response.HttpCode != HTTP_CONNECTION_ERROR_CODE || response.Attempts != 1 {
+			t.Errorf("Request ended with %d after %d attempts, expected it aborted", response.HttpCode, response.Attempts)
+		}
+	case <-time.After(time.Second):
+		t.Error("Pending request wasn't aborted")
+	}
+	if !IsInterrupted(ctx.Err()) {
+		t.Errorf("Command context got %v, expected it cancelled", ctx.Err())
+	}
+}
+
+// a command failing because its request got cancelled exits silently as interrupted
+func TestCheckErrorInterrupted(t *testing.T) {
+	events, _, restore := fakeShutdown(time.Second)
+	defer restore()
+
+	CheckError(fmt.Errorf("Request to Domain Server failed: %w", context.Canceled))
+	if code := <-events.exited; code != INTERRUPTED_EXIT_CODE {
+		t.Errorf("Exited with %d, expected %d", code, INTERRUPTED_EXIT_CODE)
+	}
+}
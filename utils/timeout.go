@@ -0,0 +1,99 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// DEFAULT_REQUEST_TIMEOUT is the longest a single HTTP call may take unless told otherwise
+const DEFAULT_REQUEST_TIMEOUT = 60 * time.Second
+
+var (
+	commandTimeout time.Duration // no deadline if zero
+	requestTimeout = DEFAULT_REQUEST_TIMEOUT
+)
+
+// SetTimeouts sets the overall deadline of the command and the timeout of every HTTP call, zero meaning no limit,
+// e.g. with the --timeout and --request-timeout flags. The deadline itself is enforced by the command context.
+func SetTimeouts(command, request time.Duration) {
+	commandTimeout = command
+	requestTimeout = request
+}
+
+// ConfigureTimeouts applies the --timeout and --request-timeout flags of the given context, falling back to the
+// 'timeout' and 'requestTimeout' config keys of the profile. The command context gets the deadline, the returned
+// function releases its resources.
+func ConfigureTimeouts(c *cli.Context) (context.CancelFunc, error) {
+	command, request := time.Duration(0), DEFAULT_REQUEST_TIMEOUT
+	if profile, err := LoadProfile(); err == nil {
+		if profile.Timeout != "" {
+			if command, err = time.ParseDuration(profile.Timeout); err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid 'timeout' config value '%s'.", profile.Timeout))
+			}
+		}
+		if profile.RequestTimeout != "" {
+			if request, err = time.ParseDuration(profile.RequestTimeout); err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid 'requestTimeout' config value '%s'.", profile.RequestTimeout))
+			}
+		}
+	} else {
+		log.Debugf("Loading profile failed, ignoring the timeouts of the config: %s", err.Error())
+	}
+	if c.IsSet("timeout") {
+		command = c.Duration("timeout")
+	}
+	if c.IsSet("request-timeout") {
+		request = c.Duration("request-timeout")
+	}
+	if command < 0 || request < 0 {
+		return nil, errors.New("Timeouts can't be negative.")
+	}
+
+	SetTimeouts(command, request)
+	if command == 0 {
+		return func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(CommandContext(c), command)
+	SetCommandContext(c.App, ctx)
+	return cancel, nil
+}
+
+// GetRequestTimeout returns the timeout to set on every HTTP client, zero meaning no timeout
+func GetRequestTimeout() time.Duration {
+	return requestTimeout
+}
+
+// TimeoutError is returned when a server didn't respond in time
+type TimeoutError struct {
+	Service string
+	After   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("Timed out after %v contacting %s.", e.After, e.Service)
+}
+
+// CheckTimeout turns the error of a call to the given service into a TimeoutError if it's due to the command deadline
+// being exceeded or the call itself timing out, other errors are returned as is
+func CheckTimeout(ctx context.Context, err error, service string) error {
+	if err == nil {
+		return nil
+	}
+	if ctx != nil && ctx.Err() == context.DeadlineExceeded {
+		return &TimeoutError{Service: service, After: commandTimeout}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &TimeoutError{Service: service, After: requestTimeout}
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/types"
+	"github.com/urfave/cli"
+)
+
+// runWithTimeouts runs a command calling the given server with the timeouts of the given flags and of the profile,
+// it returns the error message of the call if any
+func runWithTimeouts(serverURL *url.URL, args ...string) (string, error) {
+	app := cli.NewApp()
+	app.Writer = ioutil.Discard
+	app.Flags = []cli.Flag{
+		cli.DurationFlag{Name: "timeout"},
+		cli.DurationFlag{Name: "request-timeout", Value: DEFAULT_REQUEST_TIMEOUT},
+	}
+	SetCommandContext(app, context.Background())
+	cancel := func() {}
+	app.Before = func(c *cli.Context) error {
+		var err error
+		cancel, err = ConfigureTimeouts(c)
+		return err
+	}
+	message := ""
+	app.Action = func(c *cli.Context) {
+		response := NewRestHandler("", nil).Execute(&types.RestCallRequest{
+			Context: CommandContext(c),
+			Service: "Domain Server",
+			Url:     serverURL,
+			Method:  http.MethodGet,
+		}, nil)
+		if response.ErrorResponse != nil {
+			message = response.ErrorResponse.ErrorMsg
+		}
+	}
+	err := app.Run(append([]string{"tibcli"}, args...))
+	if cancel != nil {
+		cancel()
+	}
+	return message, err
+}
+
+func TestTimeouts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tas-cli-timeout-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = settings.SetSettingsDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTimeouts(0, DEFAULT_REQUEST_TIMEOUT)
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	slowURL, err := url.Parse(slow.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		args           []string
+		timeout        string // config keys
+		requestTimeout string
+		message        string
+		err            string
+	}{
+		{name: "--timeout", args: []string{"--timeout", "100ms"},
+			message: "Timed out after 100ms contacting Domain Server."},
+		{name: "--request-timeout", args: []string{"--request-timeout", "100ms"},
+			message: "Timed out after 100ms contacting Domain Server."},
+		{name: "timeout config key", timeout: "150ms",
+			message: "Timed out after 150ms contacting Domain Server."},
+		{name: "requestTimeout config key", requestTimeout: "120ms",
+			message: "Timed out after 120ms contacting Domain Server."},
+		{name: "flags override config keys", args: []string{"--timeout", "100ms"}, timeout: "10s", requestTimeout: "5s",
+			message: "Timed out after 100ms contacting Domain Server."},
+		{name: "in time", args: []string{"--timeout", "5s", "--request-timeout", "2s"}},
+		{name: "invalid config key", requestTimeout: "soon", err: "Invalid 'requestTimeout' config value 'soon'."},
+		{name: "negative", args: []string{"--timeout", "-1s"}, err: "Timeouts can't be negative."},
+	}
+
+	for _, test := range tests {
+		profile, err := settings.NewProfile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		profile.Timeout, profile.RequestTimeout = test.timeout, test.requestTimeout
+		if err = profile.Write(); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		message, err := runWithTimeouts(slowURL, test.args...)
+		elapsed := time.Since(start)
+
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: got error %v, expected '%s'", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if message != test.message {
+			t.Errorf("%s: got '%s', expected '%s'", test.name, message, test.message)
+		}
+		if test.message != "" && elapsed >= 300*time.Millisecond {
+			t.Errorf("%s: took %v, expected to give up before the server responds", test.name, elapsed)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2015-2019 TIBCO Software Inc.
+// All Rights Reserved
+
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TLSOptions configures the TLS connections to the servers, e.g. with the --ca-file, --client-cert, --client-key
+// and --insecure-skip-tls-verify flags
+type TLSOptions struct {
+	CAFile             string // PEM bundle trusted on top of the system roots
+	ClientCert         string // PEM certificate presented to the servers asking for one, along with ClientKey
+	ClientKey          string
+	InsecureSkipVerify bool // don't verify the certificates of the servers at all
+}
+
+var (
+	transportMutex  sync.Mutex
+	sharedTransport *http.Transport
+)
+
+// ConfigureTransport builds the transport shared by all web clients with the given TLS options.
+// The proxy is taken from the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+func ConfigureTransport(options TLSOptions) error {
+	tlsConfig, err := newTLSConfig(options)
+	if err != nil {
+		return err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = tlsConfig
+
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	sharedTransport = transport
+	return nil
+}
+
+// newTLSConfig builds the TLS configuration out of the given options
+func newTLSConfig(options TLSOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if options.CAFile != "" {
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Reading CA file '%s' failed: %s", options.CAFile, err.Error()))
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			log.Debugf("Loading system roots failed, only trusting '%s': %v", options.CAFile, err)
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, errors.New(fmt.Sprintf("No PEM certificate found in CA file '%s'.", options.CAFile))
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if options.ClientCert != "" || options.ClientKey != "" {
+		if options.ClientCert == "" || options.ClientKey == "" {
+			return nil, errors.New("Both the client certificate and its key must be given.")
+		}
+		cert, err := tls.LoadX509KeyPair(options.ClientCert, options.ClientKey)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Loading client certificate '%s' failed: %s", options.ClientCert, err.Error()))
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if options.InsecureSkipVerify {
+		log.Warn("TLS certificates of the servers aren't verified, the connections aren't secure.")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
+
+// GetTransport returns the transport shared by all web clients, with the default options if not configured
+func GetTransport() *http.Transport {
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+	if sharedTransport == nil {
+		sharedTransport = http.DefaultTransport.(*http.Transport).Clone()
+		sharedTransport.Proxy = http.ProxyFromEnvironment
+		sharedTransport.TLSClientConfig = &tls.Config{}
+	}
+	return sharedTransport
+}
+
+// GetTLSConfig returns a copy of the TLS configuration of the shared transport, for connections made without it
+func GetTLSConfig() *tls.Config {
+	return GetTransport().TLSClientConfig.Clone()
+}
+
+// getRoundTripper returns the shared transport, or the one replaying HAR files in replay mode,
+// wrapped to record the traffic if asked to, see ConfigureCassettes and StartHarRecording
+func getRoundTripper() http.RoundTripper {
+	var roundTripper http.RoundTripper = GetTransport()
+	if replayer != nil {
+		roundTripper = replayer
+	}
+	if cassetteRecorder != nil {
+		roundTripper = &recordingTransport{next: roundTripper, recorder: cassetteRecorder}
+	}
+	if recorder != nil {
+		roundTripper = &recordingTransport{next: roundTripper, recorder: recorder}
+	}
+	return roundTripper
+}
+
+// NewHTTPClient creates an HTTP client using the shared transport and the request timeout, with the given cookie jar
+// if not nil
+func NewHTTPClient(jar http.CookieJar) *http.Client {
+	return &http.Client{Transport: getRoundTripper(), Jar: jar, Timeout: GetRequestTimeout()}
+}
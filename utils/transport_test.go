@@ -0,0 +1,230 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// transportProxyTestEnv tells the test process is the one started to send a request through a proxy
+const transportProxyTestEnv = "TASCLI_TRANSPORT_PROXY_TEST"
+
+// testCA issues the certificates of the TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	ca := &testCA{dir: dir}
+	ca.cert, ca.key = ca.issue(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	})
+	return ca
+}
+
+// issue signs the given certificate template with the CA, or self-signs it if the CA has no certificate yet
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	parent, parentKey := template, key
+	if ca.cert != nil {
+		parent, parentKey = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// keyPair issues a certificate for the given usage and returns it as a TLS certificate
+func (ca *testCA) keyPair(t *testing.T, name string, usage x509.ExtKeyUsage) tls.Certificate {
+	cert, key := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	})
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key}
+}
+
+// writePEM writes the certificate, and the key if any, of the given key pair to PEM files named after name
+func (ca *testCA) writePEM(t *testing.T, name string, pair tls.Certificate) (string, string) {
+	certFile := path.Join(ca.dir, name+".pem")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.Certificate[0]}))
+	if pair.PrivateKey == nil {
+		return certFile, ""
+	}
+	der, err := x509.MarshalECPrivateKey(pair.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := path.Join(ca.dir, name+"-key.pem")
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	return certFile, keyFile
+}
+
+func writeFile(t *testing.T, filePath string, content []byte) {
+	if err := ioutil.WriteFile(filePath, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTLSServer starts a server with the given TLS configuration, answering "ok"
+func newTLSServer(config *tls.Config) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = config
+	// handshakes rejected by the client are expected
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	return server
+}
+
+func TestTLSOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tas-cli-transport-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer ConfigureTransport(TLSOptions{})
+
+	ca := newTestCA(t, dir, "Test CA")
+	otherCA := newTestCA(t, dir, "Other CA")
+	caFile, _ := ca.writePEM(t, "ca", tls.Certificate{Certificate: [][]byte{ca.cert.Raw}})
+	otherCAFile, _ := ca.writePEM(t, "other-ca", tls.Certificate{Certificate: [][]byte{otherCA.cert.Raw}})
+	clientCert, clientKey := ca.writePEM(t, "client", ca.keyPair(t, "client", x509.ExtKeyUsageClientAuth))
+	strangerCert, strangerKey := ca.writePEM(t, "stranger", otherCA.keyPair(t, "stranger", x509.ExtKeyUsageClientAuth))
+	notPEM := path.Join(dir, "not.pem")
+	writeFile(t, notPEM, []byte("not a certificate"))
+
+	serverCert := ca.keyPair(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	server := newTLSServer(&tls.Config{Certificates: []tls.Certificate{serverCert}})
+	defer server.Close()
+	mtlsServer := newTLSServer(&tls.Config{Certificates: []tls.Certificate{serverCert},
+		ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs})
+	defer mtlsServer.Close()
+
+	tests := []struct {
+		name      string
+		options   TLSOptions
+		url       string
+		configErr string // error configuring the transport
+		err       string // error of the request
+	}{
+		{name: "system roots only", url: server.URL, err: "certificate signed by unknown authority"},
+		{name: "CA file", options: TLSOptions{CAFile: caFile}, url: server.URL},
+		{name: "bad CA", options: TLSOptions{CAFile: otherCAFile}, url: server.URL, err: "certificate signed by unknown authority"},
+		{name: "missing CA file", options: TLSOptions{CAFile: path.Join(dir, "missing.pem")}, configErr: "Reading CA file"},
+		{name: "CA file without PEM", options: TLSOptions{CAFile: notPEM}, configErr: "No PEM certificate found"},
+		{name: "insecure", options: TLSOptions{InsecureSkipVerify: true}, url: server.URL},
+		{name: "mTLS", options: TLSOptions{CAFile: caFile, ClientCert: clientCert, ClientKey: clientKey}, url: mtlsServer.URL},
+		{name: "mTLS without client certificate", options: TLSOptions{CAFile: caFile}, url: mtlsServer.URL, err: "certificate"},
+		{name: "mTLS with unknown client certificate", options: TLSOptions{CAFile: caFile, ClientCert: strangerCert, ClientKey: strangerKey},
+			url: mtlsServer.URL, err: "certificate"},
+		{name: "client certificate without key", options: TLSOptions{ClientCert: clientCert}, configErr: "Both the client certificate and its key"},
+		{name: "mismatched key", options: TLSOptions{ClientCert: clientCert, ClientKey: strangerKey}, configErr: "Loading client certificate"},
+	}
+
+	for _, test := range tests {
+		err := ConfigureTransport(test.options)
+		if test.configErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.configErr) {
+				t.Errorf("%s: configuring got %v, expected '%s'", test.name, err, test.configErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		response, err := NewHTTPClient(nil).Get(test.url)
+		if response != nil {
+			response.Body.Close()
+		}
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.err == "" && response.StatusCode != http.StatusOK:
+			t.Errorf("%s: got %s", test.name, response.Status)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got %v, expected '%s'", test.name, err, test.err)
+		}
+	}
+}
+
+// the proxy environment variables are read once per process, the request is sent by a process started with them
+func TestProxyFromEnvironment(t *testing.T) {
+	if os.Getenv(transportProxyTestEnv) != "" {
+		response, err := NewHTTPClient(nil).Get("http://tas.example.com/platformapiversion")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if string(body) != "proxied" {
+			t.Errorf("Got '%s', expected the response of the proxy", body)
+		}
+		return
+	}
+
+	var lock sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		proxied = append(proxied, r.Method+" "+r.URL.String())
+		lock.Unlock()
+		w.Write([]byte("proxied"))
+	}))
+	defer proxy.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestProxyFromEnvironment$")
+	cmd.Env = append(os.Environ(), transportProxyTestEnv+"=1", "HTTP_PROXY="+proxy.URL, "http_proxy="+proxy.URL, "NO_PROXY=", "no_proxy=")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Request through proxy failed: %v\n%s", err, output)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(proxied) != 1 || proxied[0] != "GET http://tas.example.com/platformapiversion" {
+		t.Errorf("Proxy got %v, expected the request", proxied)
+	}
+}
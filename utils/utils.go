@@ -2,14 +2,17 @@ package utils
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/Morphyni/tas-cli/consts"
 	"github.com/Morphyni/tas-cli/settings"
+	"github.com/Morphyni/tas-cli/types"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"golang.org/x/crypto/ssh/terminal"
@@ -63,9 +66,16 @@ func (e *IncorrectUsageError) Error() string {
 
 // CheckError is a generic error checker. If the supplied error nil, this is a no-op. If
 // the error is an IncorrectUsageError, it displays the help for the command, else it displays
-// the error and exit the current application
+// the error and exit the current application. Errors due to an interrupt exit silently with INTERRUPTED_EXIT_CODE.
 func CheckError(err error) {
 	if err != nil {
+		if IsInterrupted(err) {
+			ExitInterrupted()
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = errors.New(fmt.Sprintf("Command timed out after %v.", commandTimeout))
+		}
 		switch e := err.(type) {
 		case *IncorrectUsageError:
 			fmt.Printf("Incorrect Usage: %s\n\n", e)
@@ -201,11 +211,31 @@ func PromptForPassword() string {
 	return string(pwd)
 }
 
+// PromptForSelection interactively prompts the user to pick one of the given options and returns the index of it
+func PromptForSelection(title string, options []string) int {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println(title)
+	for i, option := range options {
+		fmt.Printf("  [%d] %s\n", i+1, option)
+	}
+	for {
+		fmt.Printf("Selection (1-%d): ", len(options))
+		input, err := reader.ReadString('\n')
+		if choice, e := strconv.Atoi(strings.TrimSpace(input)); e == nil && choice >= 1 && choice <= len(options) {
+			return choice - 1
+		}
+		if err == io.EOF {
+			log.Debugf("ReadString error: %s", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
 // RestCallAndCookiesRefreshHandler will do the following things:
 // 1. load cookies from local session file prepare for the REST request
 // 2. send request/get response for the REST call
 // 3. store new cookie values from response to local session file
-func RestCallAndCookiesRefreshHandler(restCallRequest *types.RestCallRequest) (*utilities.RestHandlerV3Response, error) {
+func RestCallAndCookiesRefreshHandler(restCallRequest *types.RestCallRequest) (*types.RestCallResponse, error) {
 
 	cookieJar, err := GetCookieJar(restCallRequest.Url)
 	if err != nil {
@@ -214,19 +244,12 @@ func RestCallAndCookiesRefreshHandler(restCallRequest *types.RestCallRequest) (*
 		return nil, errors.New(errMsg)
 	}
 
-	restHandle := utilities.NewRestHandlerV3(restCallRequest.UserId, restCallRequest.RetryAttempt)
+	restHandle := NewRestHandler(restCallRequest.UserId, restCallRequest.RetryAttempt)
 
-	request := &utilities.RestHandlerV3Request{
-		Url:        restCallRequest.Url.String(),
-		Headers:    restCallRequest.Headers,
-		Method:     restCallRequest.Method,
-		CookieJar:  cookieJar,
-		Body:       restCallRequest.Body,
-		LogRequest: restCallRequest.LogRequest}
-
-	response := restHandle.ExecuteAPIV3(request)
+	response := restHandle.Execute(restCallRequest, cookieJar)
 	if response.ErrorResponse == nil {
-		// Persist new Cookie values get from response to local session file
+		// Persist new Cookie values get from response to local session file, even if interrupted meanwhile
+		// as the server already took them into account
 		refreshCookieErr := RefreshCookies(response.Cookies)
 		if refreshCookieErr != nil {
 			errMsg := fmt.Sprintf("Persist cookies failed with error : '%+v'", refreshCookieErr.Error())
@@ -234,5 +257,8 @@ func RestCallAndCookiesRefreshHandler(restCallRequest *types.RestCallRequest) (*
 			return response, errors.New(errMsg)
 		}
 	}
+	if restCallRequest.Context != nil && restCallRequest.Context.Err() != nil {
+		return response, CheckTimeout(restCallRequest.Context, restCallRequest.Context.Err(), serviceName(restCallRequest))
+	}
 	return response, nil
 }